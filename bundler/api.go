@@ -0,0 +1,471 @@
+// Package bundler merges a main package and the non-standard packages it
+// imports into a single source file, as required by competitive programming
+// judges.
+package bundler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/imports"
+)
+
+// Options configures Bundle and BundleAll.
+type Options struct {
+	// Dir is the directory Patterns are resolved in. The current directory
+	// is used if empty.
+	Dir string
+
+	// Patterns are the package patterns to load, "." if empty.
+	Patterns []string
+
+	// Check type-checks the bundled source. Bundling fails with a
+	// *CheckError if it does not compile.
+	Check bool
+
+	// TargetGo is the Go version of the judge, such as "1.20". Newer
+	// constructs are rewritten into equivalents it accepts, and bundling
+	// fails with a *DowngradeError listing those that cannot be.
+	TargetGo string
+
+	// InlineStd are std packages, such as "slices", bundled like library
+	// packages instead of imported, for judges whose Go lacks them.
+	InlineStd []string
+
+	// MaxSize is the source size limit of the judge in bytes, such as
+	// 512 << 10 on AtCoder. If the bundled source is larger, comments and
+	// blank lines are dropped and package prefixes shortened until it fits,
+	// and bundling fails with a *SizeError if it still does not. Zero means
+	// no limit.
+	MaxSize int
+
+	// Comments keeps the doc and body comments of the bundled declarations
+	// and the license header of each library package.
+	Comments bool
+
+	// Minify renames the declarations of library packages and their locals
+	// to short names. The main package keeps its names.
+	Minify bool
+
+	// Annotate is how the original position of each declaration is
+	// written, AnnotateComment if empty.
+	Annotate Annotation
+
+	// Tags are build tags to load the packages with, and GOOS and GOARCH the
+	// target system, the host's if empty, so that the files bundled are the
+	// ones the judge would build.
+	Tags   []string
+	GOOS   string
+	GOARCH string
+
+	// Profile names a judge, such as "atcoder", whose tags, target system
+	// and Go version are used where not set above.
+	Profile string
+}
+
+// Annotation is a way of writing the original positions of the bundled
+// declarations.
+type Annotation string
+
+const (
+	// AnnotateComment writes a "// pkg/file.go:line:col" comment above each
+	// declaration.
+	AnnotateComment Annotation = "comment"
+
+	// AnnotateLine writes a //line directive above each declaration, so that
+	// compiler errors and stack traces point at the original file.
+	AnnotateLine Annotation = "line"
+
+	// AnnotateNone writes nothing.
+	AnnotateNone Annotation = "none"
+)
+
+// Result is a bundled main package.
+type Result struct {
+	// Package is the import path of the main package, Dir its directory.
+	Package string
+	Dir     string
+
+	// Source is the formatted bundled source.
+	Source []byte
+
+	// Packages are the import paths of the bundled packages, main first.
+	Packages []string
+
+	// Files are the source files of the bundled packages.
+	Files []string
+
+	// Decls counts the bundled declarations by package import path.
+	Decls map[string]DeclCounts
+
+	// SourceMap maps lines of Source back to the original sources.
+	SourceMap *SourceMap
+
+	// Inclusions explain why each declaration is bundled.
+	Inclusions []Inclusion
+
+	// Graph is the import graph and the declaration graph of the bundle.
+	Graph Graph
+
+	// Stats breaks the size of Source down by package.
+	Stats Stats
+
+	// Compactions are the size reductions applied to fit Options.MaxSize,
+	// in order.
+	Compactions []string
+}
+
+// DeclCounts counts bundled declarations by kind.
+type DeclCounts struct {
+	Types   int
+	Funcs   int
+	Methods int
+	Consts  int
+	Vars    int
+}
+
+// Bundle bundles the single main package matched by opts.
+func Bundle(ctx context.Context, opts Options) (Result, error) {
+	results, err := BundleAll(ctx, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(results) > 1 {
+		return Result{}, fmt.Errorf("%d main packages found, use BundleAll", len(results))
+	}
+	return results[0], nil
+}
+
+// BundleAll bundles every main package matched by opts. All packages are
+// loaded at once, so shared dependencies are type-checked only once.
+// Packages written by go-bundler itself are skipped.
+func BundleAll(ctx context.Context, opts Options) ([]Result, error) {
+	switch opts.Annotate {
+	case "", AnnotateComment, AnnotateLine, AnnotateNone:
+	default:
+		return nil, fmt.Errorf("unknown annotation %q, want comment, line or none", opts.Annotate)
+	}
+	opts, err := applyProfile(opts)
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := loadPackages(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	mains := mainPackages(pkgs)
+	if len(mains) == 0 {
+		return nil, fmt.Errorf("main package not found")
+	}
+	if err := loadErrors(mains); err != nil {
+		return nil, err
+	}
+
+	// bundling edits the syntax of the bundled packages, so each main
+	// package is bundled from its own copy of them
+	b := &Bundler{opts: opts}
+	if err := b.initInlineStd(); err != nil {
+		return nil, err
+	}
+	results := make([]Result, 0, len(mains))
+	for _, p := range mains {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		r, err := bundleMain(clonePackages(p, b.isExternal), opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.PkgPath, err)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func bundleMain(p *packages.Package, opts Options) (Result, error) {
+	var raw bytes.Buffer
+	b, err := bundle([]*packages.Package{p}, opts, &raw)
+	if err != nil {
+		return Result{}, err
+	}
+
+	src, err := formatSource(raw.Bytes())
+	if err != nil {
+		return Result{}, fmt.Errorf("goimports: %w", err)
+	}
+	if err := checkImports(src); err != nil {
+		return Result{}, err
+	}
+	if opts.Annotate == AnnotateLine {
+		if src, err = b.lineDirectives(src); err != nil {
+			return Result{}, err
+		}
+	}
+	if opts.Minify {
+		if src, err = b.minify(src); err != nil {
+			return Result{}, fmt.Errorf("minify: %w", err)
+		}
+	}
+	var compactions []string
+	if opts.MaxSize > 0 {
+		src, compactions, err = b.fitSize(src)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	if opts.Check {
+		if err := Check(src); err != nil {
+			return Result{}, err
+		}
+	}
+
+	srcMap, err := b.sourceMap(src)
+	if err != nil {
+		return Result{}, err
+	}
+	stats, err := b.stats(src)
+	if err != nil {
+		return Result{}, err
+	}
+	r := Result{
+		Package:     p.PkgPath,
+		Source:      src,
+		Decls:       b.declCounts(),
+		SourceMap:   srcMap,
+		Inclusions:  b.inclusions(),
+		Graph:       b.graph(),
+		Stats:       stats,
+		Compactions: compactions,
+	}
+	if len(p.GoFiles) > 0 {
+		r.Dir = filepath.Dir(p.GoFiles[0])
+	}
+	for _, q := range b.topoPkgs {
+		r.Packages = append(r.Packages, q.PkgPath)
+		r.Files = append(r.Files, slices.Concat(q.GoFiles, q.OtherFiles)...)
+	}
+	return r, nil
+}
+
+// declCounts counts the bundled declarations by package.
+func (b *Bundler) declCounts() map[string]DeclCounts {
+	counts := make(map[string]DeclCounts, len(b.topoPkgs))
+	for _, decl := range b.bundled.Decls {
+		pp, ok := b.declPkg(decl)
+		if !ok {
+			continue
+		}
+
+		c := counts[string(pp)]
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil {
+				c.Methods++
+			} else {
+				c.Funcs++
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					c.Types++
+				case *ast.ValueSpec:
+					if d.Tok == token.CONST {
+						c.Consts += len(s.Names)
+					} else {
+						c.Vars += len(s.Names)
+					}
+				}
+			}
+		}
+		counts[string(pp)] = c
+	}
+	return counts
+}
+
+// loadPackages loads the packages matching opts.Patterns, "." if none,
+// relative to opts.Dir in a single call, so shared dependencies are
+// type-checked once. Files are selected by the build tags and target system
+// of opts.
+func loadPackages(ctx context.Context, opts Options) ([]*packages.Package, error) {
+	dir, patterns := opts.Dir, opts.Patterns
+	if dir == "" {
+		dir = "."
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get abs path of %s", dir)
+	}
+
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode: packages.NeedName |
+			packages.NeedFiles |
+			packages.NeedSyntax |
+			packages.NeedTypes |
+			packages.NeedTypesInfo |
+			packages.NeedDeps |
+			packages.NeedModule |
+			packages.NeedCompiledGoFiles |
+			packages.NeedImports |
+			packages.NeedEmbedFiles,
+		Dir:   absDir,
+		Tests: false,
+	}
+	if len(opts.Tags) > 0 {
+		cfg.BuildFlags = []string{"-tags=" + strings.Join(opts.Tags, ",")}
+	}
+	if opts.GOOS != "" || opts.GOARCH != "" {
+		cfg.Env = os.Environ()
+		if opts.GOOS != "" {
+			cfg.Env = append(cfg.Env, "GOOS="+opts.GOOS)
+		}
+		if opts.GOARCH != "" {
+			cfg.Env = append(cfg.Env, "GOARCH="+opts.GOARCH)
+		}
+	}
+
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load package: %w", err)
+	}
+
+	return pkgs, nil
+}
+
+// LoadError is returned when a package imported by a main package, or the
+// main package itself, fails to load, parse or type-check, since its type
+// information is then incomplete.
+type LoadError struct {
+	Errors []PackageError
+}
+
+func (e *LoadError) Error() string {
+	lines := make([]string, 0, len(e.Errors))
+	for _, pe := range e.Errors {
+		lines = append(lines, pe.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// PackageError is an error of one package.
+type PackageError struct {
+	Package string
+	// Pos is the position of the error, invalid if unknown.
+	Pos token.Position
+	Msg string
+}
+
+func (e PackageError) String() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.Package, e.Msg)
+}
+
+// loadErrors returns a *LoadError with the errors of every package in the
+// import graph of mains, dependencies first, or nil if there are none.
+func loadErrors(mains []*packages.Package) error {
+	var errs []PackageError
+	packages.Visit(mains, nil, func(p *packages.Package) {
+		for _, e := range p.Errors {
+			errs = append(errs, PackageError{
+				Package: p.PkgPath,
+				Pos:     parseErrorPos(e.Pos),
+				Msg:     e.Msg,
+			})
+		}
+	})
+	if len(errs) == 0 {
+		return nil
+	}
+	return &LoadError{Errors: errs}
+}
+
+// parseErrorPos parses the "file:line:col" or "file:line" position of a
+// packages.Error, which is empty or "-" if unknown.
+func parseErrorPos(s string) token.Position {
+	var pos token.Position
+	var nums []int
+	for len(nums) < 2 {
+		i := strings.LastIndexByte(s, ':')
+		if i < 0 {
+			break
+		}
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			break
+		}
+		nums = append([]int{n}, nums...)
+		s = s[:i]
+	}
+	if len(nums) == 0 || s == "" {
+		return pos
+	}
+	pos.Filename, pos.Line = s, nums[0]
+	if len(nums) == 2 {
+		pos.Column = nums[1]
+	}
+	return pos
+}
+
+// mainPackages returns the main packages of pkgs, skipping the ones written
+// by go-bundler itself.
+func mainPackages(pkgs []*packages.Package) []*packages.Package {
+	mains := make([]*packages.Package, 0, len(pkgs))
+	for _, p := range pkgs {
+		if p.Name == "main" && !isBundled(p) {
+			mains = append(mains, p)
+		}
+	}
+	return mains
+}
+
+func isBundled(p *packages.Package) bool {
+	for _, f := range p.Syntax {
+		if len(f.Comments) > 0 && f.Comments[0].List[0].Text == generatedHeader {
+			return true
+		}
+	}
+	return false
+}
+
+// checkImports returns an error if src imports an internal package, which
+// only inlined std packages may do.
+func checkImports(src []byte) error {
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", src, parser.ImportsOnly)
+	if err != nil {
+		return err
+	}
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(strings.Split(path, "/"), "internal") {
+			return fmt.Errorf("bundle imports %s, which cannot be imported from main", path)
+		}
+	}
+	return nil
+}
+
+// formatSource formats the bundled source with goimports.
+func formatSource(raw []byte) ([]byte, error) {
+	return imports.Process("main.go", raw, &imports.Options{
+		Comments:  true,
+		TabIndent: true,
+		TabWidth:  4,
+	})
+}
@@ -1,15 +1,16 @@
-package main
+package bundler
 
 import (
 	"errors"
 	"fmt"
 	"go/ast"
-	"go/format"
+	"go/parser"
 	"go/token"
 	"go/types"
 	"io"
 	"path/filepath"
 	"slices"
+	"strings"
 
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
@@ -21,50 +22,81 @@ type (
 	pkgPrefix string
 )
 
+// generatedHeader is the first line of every bundled file.
+const generatedHeader = "// Code generated by go-bundler; DO NOT EDIT."
+
 type Bundler struct {
 	// input
 	pkgs []*packages.Package
+	opts Options
 
 	// cache
 	mainPkg   *packages.Package
 	topoPkgs  []*packages.Package
+	initPkgs  []*packages.Package
+	inlineStd map[pkgPath]bool
 	prefixes  map[pkgPath]pkgPrefix
 	pkgPaths  map[string]pkgPath
 	pkgByPath map[pkgPath]*packages.Package
+	files     map[string]*ast.File
 	replaced  map[ast.Node]string
+	analysis  *ReachabilityAnalyzer
+	embeds    map[*ast.ValueSpec]embedVar
 
 	// output
 	bundled *ast.File
+	declPos map[ast.Decl]token.Pos
 }
 
-func Bundle(pkgs []*packages.Package, w io.Writer) error {
+// bundle writes the unformatted bundled source of the main package in pkgs
+// to w.
+func bundle(pkgs []*packages.Package, opts Options, w io.Writer) (*Bundler, error) {
 	// init
-	b := &Bundler{pkgs: pkgs}
+	b := &Bundler{pkgs: pkgs, opts: opts}
 	if err := b.Init(); err != nil {
-		return err
+		return nil, err
+	}
+	if err := b.preflight(); err != nil {
+		return nil, err
 	}
+	if err := b.inlineEmbeds(); err != nil {
+		return nil, err
+	}
+	b.stripDebug()
 
 	// bundle
 	file, err := b.buildDeclFile()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := b.checkEmbedFS(file); err != nil {
+		return nil, err
+	}
+	if opts.TargetGo != "" {
+		if err := b.downgrade(file, opts.TargetGo); err != nil {
+			return nil, err
+		}
 	}
 	b.applyPrefixes(file)
+	if err := b.addEmbedHelpers(file); err != nil {
+		return nil, err
+	}
 
-	// format
-	fmt.Fprintln(w, `// Code generated by go-bundler; DO NOT EDIT.`)
-	fmt.Fprintln(w)
-	if err := format.Node(w, b.pkgs[0].Fset, b.bundled); err != nil {
-		return err
+	if err := b.printBundle(w); err != nil {
+		return nil, err
 	}
-	return nil
+	return b, nil
 }
 
 func (b *Bundler) Init() error {
 	if err := b.searchMainPkg(); err != nil {
 		return err
 	}
+	if err := b.initInlineStd(); err != nil {
+		return err
+	}
 	b.topologicalSortPkgs()
+	b.sortInitOrder()
 	b.generatePrefixes()
 	b.initPkgMaps()
 	return nil
@@ -81,6 +113,25 @@ func (b *Bundler) searchMainPkg() error {
 	return errors.New("main package not found")
 }
 
+// initInlineStd collects the std packages bundled like library packages.
+func (b *Bundler) initInlineStd() error {
+	b.inlineStd = make(map[pkgPath]bool, len(b.opts.InlineStd))
+	for _, path := range b.opts.InlineStd {
+		pp := pkgPath(path)
+		if !isStd(pp) {
+			return fmt.Errorf("inline std: %s is not a standard package", path)
+		}
+		b.inlineStd[pp] = true
+	}
+	return nil
+}
+
+// isExternal reports whether pp is imported by the bundle instead of being
+// bundled into it.
+func (b *Bundler) isExternal(pp pkgPath) bool {
+	return isStd(pp) && !b.inlineStd[pp]
+}
+
 func (b *Bundler) topologicalSortPkgs() {
 	visited := make(map[pkgPath]bool)
 	b.topoPkgs = make([]*packages.Package, 0, 128)
@@ -90,12 +141,18 @@ func (b *Bundler) topologicalSortPkgs() {
 		// ignore std package
 		// ignore visited package
 		pp := pkgPath(p.PkgPath)
-		if visited[pp] || isStd(pp) {
+		if visited[pp] || b.isExternal(pp) {
 			return
 		}
 		visited[pp] = true
-		for _, q := range p.Imports {
-			dfs(q)
+		// visit imports by path so that the output is deterministic
+		paths := make([]string, 0, len(p.Imports))
+		for path := range p.Imports {
+			paths = append(paths, path)
+		}
+		slices.Sort(paths)
+		for _, path := range paths {
+			dfs(p.Imports[path])
 		}
 		b.topoPkgs = append(b.topoPkgs, p)
 	}
@@ -106,6 +163,40 @@ func (b *Bundler) topologicalSortPkgs() {
 	}
 }
 
+// sortInitOrder orders packages as the Go spec initializes them: packages are
+// sorted by import path and the first one whose imports are all initialized
+// is picked repeatedly.
+func (b *Bundler) sortInitOrder() {
+	pkgs := slices.Clone(b.topoPkgs)
+	slices.SortFunc(pkgs, func(x, y *packages.Package) int {
+		return strings.Compare(x.PkgPath, y.PkgPath)
+	})
+
+	done := make(map[pkgPath]bool, len(pkgs))
+	ready := func(p *packages.Package) bool {
+		for _, q := range p.Imports {
+			qp := pkgPath(q.PkgPath)
+			if !b.isExternal(qp) && !done[qp] {
+				return false
+			}
+		}
+		return true
+	}
+
+	b.initPkgs = make([]*packages.Package, 0, len(pkgs))
+	for len(b.initPkgs) < len(pkgs) {
+		for _, p := range pkgs {
+			pp := pkgPath(p.PkgPath)
+			if done[pp] || !ready(p) {
+				continue
+			}
+			done[pp] = true
+			b.initPkgs = append(b.initPkgs, p)
+			break
+		}
+	}
+}
+
 func (b *Bundler) generatePrefixes() {
 	pkgPathsByPkgName := make(map[pkgName][]pkgPath)
 	for _, now := range b.topoPkgs {
@@ -131,6 +222,7 @@ func (b *Bundler) generatePrefixes() {
 func (b *Bundler) initPkgMaps() {
 	b.pkgPaths = make(map[string]pkgPath)
 	b.pkgByPath = make(map[pkgPath]*packages.Package)
+	b.files = make(map[string]*ast.File)
 
 	for _, pkg := range b.topoPkgs {
 		for _, f := range pkg.Syntax {
@@ -139,19 +231,25 @@ func (b *Bundler) initPkgMaps() {
 			fp := filepath.ToSlash(pos.Filename)
 			b.pkgPaths[fp] = pp
 			b.pkgByPath[pp] = pkg
+			b.files[fp] = f
 		}
 	}
 }
 
 func (b *Bundler) buildDeclFile() (*ast.File, error) {
-	reachable := AnalyzeReachableDecls(b.mainPkg, b.topoPkgs)
-	builder := NewBuilder(b.mainPkg.Fset, b.pkgPaths)
+	b.analysis = analyzeReachability(b.mainPkg, b.topoPkgs)
+	reachable := b.analysis.reachableDecls
+	builder := NewBuilder(b.isExternal)
+	initDecls := make(map[pkgPath][]*ast.FuncDecl, len(b.topoPkgs))
+
+	varSpecs := make(map[pkgPath][]*ast.ValueSpec, len(b.topoPkgs))
 
 	for _, pkg := range b.topoPkgs {
 		info := pkg.TypesInfo
+		pp := pkgPath(pkg.PkgPath)
 		for _, f := range pkg.Syntax {
-			ast.Inspect(f, func(n ast.Node) bool {
-				switch v := n.(type) {
+			for _, decl := range f.Decls {
+				switch v := decl.(type) {
 				case *ast.GenDecl:
 					switch v.Tok {
 					case token.IMPORT:
@@ -160,8 +258,8 @@ func (b *Bundler) buildDeclFile() (*ast.File, error) {
 								builder.addImportSpec(importSpec)
 							}
 						}
-						return false
 					case token.TYPE:
+						moveDocToSpec(v)
 						for _, spec := range v.Specs {
 							if typeSpec, ok := spec.(*ast.TypeSpec); ok {
 								if obj, ok := info.Defs[typeSpec.Name]; ok && reachable[obj] {
@@ -170,36 +268,29 @@ func (b *Bundler) buildDeclFile() (*ast.File, error) {
 							}
 						}
 					case token.VAR:
+						// vars are laid out by layoutInit to keep initialization order
+						moveDocToSpec(v)
 						for _, spec := range v.Specs {
 							if varSpec, ok := spec.(*ast.ValueSpec); ok {
-								var used bool
-								for _, name := range varSpec.Names {
-									if obj, ok := info.Defs[name]; ok && isPkgLevelVar(obj) && reachable[obj] {
-										used = true
-									}
-								}
-								if used {
-									builder.addValueSpec(varSpec)
-								}
+								varSpecs[pp] = append(varSpecs[pp], varSpec)
 							}
 						}
 					case token.CONST:
-						var used bool
-						for _, spec := range v.Specs {
-							if constSpec, ok := spec.(*ast.ValueSpec); ok {
-								for _, name := range constSpec.Names {
-									if obj, ok := info.Defs[name]; ok && isPkgLevelConst(obj) && reachable[obj] {
-										used = true
-									}
-								}
-							}
-						}
-						if used {
-							builder.addConstDecl(v)
+						if pruned := pruneConstDecl(info, f, v, reachable); pruned != nil {
+							builder.addConstDecl(pruned)
 						}
 					}
 				case *ast.FuncDecl:
+					if v.Recv == nil && v.Name.Name == "init" {
+						// init always runs, whether or not it is referenced
+						initDecls[pp] = append(initDecls[pp], v)
+						break
+					}
 					if obj, ok := info.Defs[v.Name]; ok && reachable[obj] {
+						if v.Body == nil {
+							// implemented in assembly or linked from the runtime
+							return nil, fmt.Errorf("%s: %s has no Go body", pkg.Fset.Position(v.Pos()), obj.Name())
+						}
 						if !isFuncNonMethod(obj) {
 							// method
 							builder.addFuncDecl(v)
@@ -207,8 +298,6 @@ func (b *Bundler) buildDeclFile() (*ast.File, error) {
 						}
 						// func
 						switch v.Name.Name {
-						case "init":
-							builder.addInitDecl(v)
 						case "main":
 							builder.setMainDecl(v)
 						default:
@@ -216,15 +305,38 @@ func (b *Bundler) buildDeclFile() (*ast.File, error) {
 						}
 					}
 				}
-				return true
-			})
+			}
 		}
 	}
+
+	if err := b.layoutInit(builder, reachable, varSpecs, initDecls); err != nil {
+		return nil, err
+	}
+
 	file, err := builder.Build()
 	b.bundled = file
+	b.declPos = builder.declPos
 	return file, err
 }
 
+// moveDocToSpec moves the doc comment of an unparenthesized declaration to
+// its spec, since the spec is declared on its own in the bundle.
+func moveDocToSpec(d *ast.GenDecl) {
+	if d.Lparen.IsValid() || len(d.Specs) != 1 || d.Doc == nil {
+		return
+	}
+	switch s := d.Specs[0].(type) {
+	case *ast.TypeSpec:
+		if s.Doc == nil {
+			s.Doc = d.Doc
+		}
+	case *ast.ValueSpec:
+		if s.Doc == nil {
+			s.Doc = d.Doc
+		}
+	}
+}
+
 func (b *Bundler) applyPrefixes(file *ast.File) {
 	b.replaced = make(map[ast.Node]string, 128)
 	astutil.Apply(file, func(c *astutil.Cursor) bool {
@@ -243,14 +355,14 @@ func (b *Bundler) rewriteSelector(c *astutil.Cursor, n *ast.SelectorExpr) {
 	if !ok {
 		return
 	}
-	if pp, ok := isPkgSelector(n, info); ok {
+	if pp, ok := isPkgSelector(n, info, b.isExternal); ok {
 		if prefixAdded, ok := b.addPrefix(pp, n.Sel); ok {
 			dst := ast.NewIdent(prefixAdded)
 			dst.NamePos = n.Sel.NamePos
 			c.Replace(dst)
 			b.replaced[n.Sel] = prefixAdded
 		}
-	} else if pp, ok := isEmbeddedSel(n, info); ok {
+	} else if pp, ok := isEmbeddedSel(n, info, b.isExternal); ok {
 		if prefixAdded, ok := b.addPrefix(pp, n.Sel); ok {
 			n.Sel.Name = prefixAdded
 			b.replaced[n.Sel] = prefixAdded
@@ -271,7 +383,7 @@ func (b *Bundler) rewriteIdent(n *ast.Ident) {
 		return
 	}
 
-	if pp, ok := isEmbeddedFieldKey(n, info); ok {
+	if pp, ok := isEmbeddedFieldKey(n, info, b.isExternal); ok {
 		if prefixAdded, ok := b.addPrefix(pp, n); ok {
 			n.Name = prefixAdded
 			b.replaced[n] = prefixAdded
@@ -291,6 +403,37 @@ func (b *Bundler) addPrefix(pp pkgPath, src *ast.Ident) (string, bool) {
 	return fmt.Sprintf("%s_%s", string(prefix), src.Name), true
 }
 
+// typeExpr returns an expression denoting t in the bundled file. Named types
+// of bundled packages are referred to by their prefixed names.
+func (b *Bundler) typeExpr(t types.Type) (ast.Expr, error) {
+	const marker = "bundler_pkg_"
+	qualifier := func(p *types.Package) string {
+		pp := pkgPath(p.Path())
+		if prefix, ok := b.prefixes[pp]; ok {
+			return marker + string(prefix)
+		}
+		return p.Name()
+	}
+	expr, err := parser.ParseExpr(types.TypeString(t, qualifier))
+	if err != nil {
+		return nil, fmt.Errorf("type %s cannot be written in the bundle: %w", t, err)
+	}
+
+	// marker.Name -> prefix_Name
+	expr = astutil.Apply(expr, func(c *astutil.Cursor) bool {
+		sel, ok := c.Node().(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok && strings.HasPrefix(x.Name, marker) {
+			prefix := strings.TrimPrefix(x.Name, marker)
+			c.Replace(ast.NewIdent(prefix + "_" + sel.Sel.Name))
+		}
+		return true
+	}, nil).(ast.Expr)
+	return expr, nil
+}
+
 func (b *Bundler) infoOfNode(n ast.Node) (*packages.Package, *types.Info, bool) {
 	if n == nil {
 		return nil, nil, false
@@ -309,6 +452,20 @@ func (b *Bundler) infoOfNode(n ast.Node) (*packages.Package, *types.Info, bool)
 	return nil, nil, false
 }
 
+// initFuncNames returns n names for the init functions of pkg which do not
+// collide with any package-level declaration.
+func initFuncNames(pkg *packages.Package, n int) []string {
+	names := make([]string, 0, n)
+	for i := 0; len(names) < n; i++ {
+		name := fmt.Sprintf("init%d", i)
+		if pkg.Types != nil && pkg.Types.Scope().Lookup(name) != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
 func isPkgLevelVar(obj types.Object) bool {
 	v, ok := obj.(*types.Var)
 	if !ok {
@@ -346,7 +503,7 @@ func isFuncNonMethod(obj types.Object) bool {
 }
 
 // isPkgSelector returns pkgPath if sel is pkg.Sel
-func isPkgSelector(sel *ast.SelectorExpr, info *types.Info) (pkgPath, bool) {
+func isPkgSelector(sel *ast.SelectorExpr, info *types.Info, external func(pkgPath) bool) (pkgPath, bool) {
 	if info.Selections[sel] != nil {
 		// ignore structure field and method
 		return "", false
@@ -369,9 +526,9 @@ func isPkgSelector(sel *ast.SelectorExpr, info *types.Info) (pkgPath, bool) {
 		return "", false
 	}
 
-	//should be non std pkg
+	//should be bundled pkg
 	pp := pkgPath(p.Path())
-	if isStd(pp) {
+	if external(pp) {
 		return "", false
 	}
 	return pp, true
@@ -389,7 +546,7 @@ func namedTypeOf(t types.Type) *types.Named {
 	return nil
 }
 
-func isEmbeddedSel(sel *ast.SelectorExpr, info *types.Info) (pkgPath, bool) {
+func isEmbeddedSel(sel *ast.SelectorExpr, info *types.Info, external func(pkgPath) bool) (pkgPath, bool) {
 	s := info.Selections[sel]
 	if s == nil || s.Kind() != types.FieldVal {
 		return "", false
@@ -410,7 +567,7 @@ func isEmbeddedSel(sel *ast.SelectorExpr, info *types.Info) (pkgPath, bool) {
 		return "", false
 	}
 	pp := pkgPath(obj.Pkg().Path())
-	if isStd(pp) {
+	if external(pp) {
 		return "", false
 	}
 	return pp, true
@@ -436,7 +593,7 @@ func isPkgLevelIdent(pkg *packages.Package, info *types.Info, id *ast.Ident) boo
 	return obj.Pkg() == pkg.Types && obj.Parent() == pkg.Types.Scope()
 }
 
-func isEmbeddedFieldKey(id *ast.Ident, info *types.Info) (pkgPath, bool) {
+func isEmbeddedFieldKey(id *ast.Ident, info *types.Info, external func(pkgPath) bool) (pkgPath, bool) {
 	obj, ok := info.Uses[id].(*types.Var)
 	if !ok || !obj.Anonymous() {
 		return "", false
@@ -453,7 +610,7 @@ func isEmbeddedFieldKey(id *ast.Ident, info *types.Info) (pkgPath, bool) {
 	}
 
 	pp := pkgPath(typeObj.Pkg().Path())
-	if isStd(pp) {
+	if external(pp) {
 		return "", false
 	}
 	return pp, true
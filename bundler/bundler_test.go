@@ -0,0 +1,934 @@
+package bundler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func bundleTestPackage(t *testing.T, dir string) Result {
+	t.Helper()
+	r, err := Bundle(context.Background(), Options{Dir: filepath.Join("testdata/src", dir)})
+	if err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+	return r
+}
+
+func TestBundler(t *testing.T) {
+	tests := []struct {
+		name     string
+		testdir  string
+		targetGo string
+		minify   bool
+		comments bool
+		tags     []string
+		goos     string
+		wantErr  bool
+	}{
+		{
+			name:    "no dependencies",
+			testdir: "no-deps",
+		},
+		{
+			name:    "single dependencies",
+			testdir: "single-deps",
+		},
+		{
+			name:    "init order with diamond imports",
+			testdir: "init-order",
+		},
+		{
+			name:    "var initialization across packages",
+			testdir: "init-vars",
+		},
+		{
+			name:    "stdin and exit code",
+			testdir: "stdin",
+		},
+		{
+			name:    "const and var group pruning",
+			testdir: "groups",
+		},
+		{
+			name:    "method pruning",
+			testdir: "methods",
+		},
+		{
+			name:     "lowering to an older Go version",
+			testdir:  "downgrade",
+			targetGo: "1.20",
+		},
+		{
+			name:    "minification",
+			testdir: "minify",
+			minify:  true,
+		},
+		{
+			name:     "doc, body and license comments",
+			testdir:  "comments",
+			comments: true,
+		},
+		{
+			name:    "debug code stripping",
+			testdir: "debug",
+		},
+		{
+			name:    "build tags and target system",
+			testdir: "tags",
+			tags:    []string{"debug"},
+			goos:    "windows",
+		},
+		{
+			name:     "go:embed files inlined",
+			testdir:  "embed",
+			comments: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// execute
+			r, err := Bundle(context.Background(), Options{
+				Dir:      filepath.Join("testdata/src", tt.testdir),
+				TargetGo: tt.targetGo,
+				Minify:   tt.minify,
+				Comments: tt.comments,
+				Tags:     tt.tags,
+				GOOS:     tt.goos,
+			})
+
+			// validate
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Bundle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if err := Check(r.Source); err != nil {
+				t.Errorf("Check() error =\n%v", err)
+			}
+			if tt.targetGo != "" {
+				checkGoVersion(t, r.Source, "go"+tt.targetGo)
+			}
+			compareGolden(t, filepath.Join("testdata/src", tt.testdir, "bundled.golden"), r.Source)
+		})
+	}
+}
+
+// checkGoVersion type-checks src as Go version v.
+func checkGoVersion(t *testing.T, src []byte, v string) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{GoVersion: v, Importer: importer.Default()}
+	if _, err := conf.Check("main", fset, []*ast.File{file}, nil); err != nil {
+		t.Errorf("type-check as %s: %v", v, err)
+	}
+}
+
+// compareGolden compares got with the golden file, or rewrites the golden
+// file with -update.
+func compareGolden(t *testing.T, golden string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s (run go test -update to accept it)\ngot:\n%s", golden, got)
+	}
+}
+
+func TestBundlerInitOrder(t *testing.T) {
+	r := bundleTestPackage(t, "init-order")
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", r.Source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inits int
+	var calls []string
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "init" {
+			continue
+		}
+		inits++
+		for _, stmt := range fn.Body.List {
+			call := stmt.(*ast.ExprStmt).X.(*ast.CallExpr)
+			calls = append(calls, call.Fun.(*ast.Ident).Name)
+		}
+	}
+
+	if inits != 1 {
+		t.Errorf("init functions = %d, want 1", inits)
+	}
+	want := []string{"c_init0", "c_init1", "c_init2", "a_init0", "b_init0", "main_init0", "main_init1"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("init calls = %v, want %v", calls, want)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	src := `package main
+
+// example.com/lib/lib.go:10:1
+func lib_F() int {
+	return "x"
+}
+
+func main() {
+	lib_F()
+	undefined()
+}
+`
+	err := Check([]byte(src))
+	var checkErr *CheckError
+	if !errors.As(err, &checkErr) {
+		t.Fatalf("Check() error = %v, want *CheckError", err)
+	}
+
+	want := []string{"example.com/lib/lib.go:11", "main.go:10:2"}
+	var got []string
+	for _, d := range checkErr.Diagnostics {
+		if d.Orig.IsValid() {
+			got = append(got, d.Orig.String())
+		} else {
+			got = append(got, d.Pos.String())
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("diagnostic positions = %v, want %v", got, want)
+	}
+}
+
+func TestMethodPruning(t *testing.T) {
+	r := bundleTestPackage(t, "methods")
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", r.Source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	methods := make(map[string]bool)
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil {
+			continue
+		}
+		recv := fn.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = star.X
+		}
+		if index, ok := recv.(*ast.IndexExpr); ok {
+			recv = index.X
+		}
+		methods[recv.(*ast.Ident).Name+"."+fn.Name.Name] = true
+	}
+
+	for name, want := range map[string]bool{
+		// called
+		"ds_UnionFind.Find":  true,
+		"ds_UnionFind.Union": true,
+		"ds_UnionFind.Same":  false,
+		"ds_UnionFind.Size":  false,
+		"ds_Stack.Push":      true,
+		"ds_Stack.Peek":      false,
+		"main_ModInt.Add":    true,
+		"main_ModInt.Mul":    false,
+		// called through interfaces
+		"main_ModInt.String": true,
+		"main_byLen.Swap":    true,
+		"main_byLen.Total":   false,
+		// needed to implement interfaces
+		"main_Square.Area":      true,
+		"main_Square.Perimeter": true,
+		"main_Square.Diagonal":  false,
+		"main_Greeting.Hello":   true,
+		"main_Greeting.Bye":     false,
+		// needed to satisfy constraints
+		"main_Num.Zero": true,
+		"main_Num.Neg":  false,
+	} {
+		if methods[name] != want {
+			t.Errorf("method %s bundled = %v, want %v", name, methods[name], want)
+		}
+	}
+}
+
+func TestWhy(t *testing.T) {
+	r := bundleTestPackage(t, "methods")
+
+	tests := []struct {
+		name string
+		path []WhyStep
+	}{
+		{
+			name: "main.main",
+			path: []WhyStep{{"main.main", ReasonEntry}},
+		},
+		{
+			name: "ds.UnionFind.Find",
+			path: []WhyStep{{"main.main", ReasonEntry}, {"ds.UnionFind.Find", ReasonCalled}},
+		},
+		{
+			name: "main.Num.Zero",
+			path: []WhyStep{{"main.main", ReasonEntry}, {"main.Num.Zero", ReasonInterface}},
+		},
+		{
+			// qualified by import path
+			name: "github.com/Atnuhs/go-bundler/bundler/testdata/src/methods/ds.Stack",
+			path: []WhyStep{{"main.main", ReasonEntry}, {"ds.Stack", ReasonType}},
+		},
+	}
+	for _, tt := range tests {
+		got := r.Why(tt.name)
+		if len(got) != 1 {
+			t.Errorf("Why(%q) = %d inclusions, want 1", tt.name, len(got))
+			continue
+		}
+		if !slices.Equal(got[0].Path, tt.path) {
+			t.Errorf("Why(%q).Path = %v, want %v", tt.name, got[0].Path, tt.path)
+		}
+	}
+
+	if got := r.Why("main.Num.Neg"); len(got) != 0 {
+		t.Errorf("Why(main.Num.Neg) = %v, want none", got)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	r := bundleTestPackage(t, "methods")
+	g := r.Graph
+
+	const mainPath = "github.com/Atnuhs/go-bundler/bundler/testdata/src/methods"
+	const dsPath = mainPath + "/ds"
+	if len(g.Packages) != 2 || g.Packages[0].Path != mainPath || !slices.Equal(g.Packages[0].Imports, []string{dsPath}) {
+		t.Errorf("Packages = %v, want ds and main importing ds", g.Packages)
+	}
+
+	decls := make(map[string]GraphDecl)
+	for _, d := range g.Decls {
+		decls[d.Decl] = d
+	}
+	for name, want := range map[string]struct {
+		kind      string
+		reachable bool
+	}{
+		"main.main":         {"func", true},
+		"main.init":         {"init", true},
+		"main.Num":          {"type", true},
+		"main.Num.Zero":     {"method", true},
+		"main.Num.Neg":      {"method", false},
+		"ds.UnionFind.Same": {"method", false},
+	} {
+		d, ok := decls[name]
+		if !ok {
+			t.Errorf("%s missing from Decls", name)
+			continue
+		}
+		if d.Kind != want.kind || d.Reachable != want.reachable {
+			t.Errorf("%s: kind %q, reachable %v, want %q, %v", name, d.Kind, d.Reachable, want.kind, want.reachable)
+		}
+	}
+	find := GraphEdge{To: dsPath + ".UnionFind.Find", Reason: ReasonCalled}
+	if !slices.Contains(decls["main.main"].Edges, find) {
+		t.Errorf("main.main edges = %v, want %v", decls["main.main"].Edges, find)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Graph
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, g) {
+		t.Errorf("JSON round trip = %+v, want %+v", decoded, g)
+	}
+
+	buf.Reset()
+	if err := g.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := `"` + mainPath + `.Num.Neg" [label="main.Num.Neg", style=dashed];`; !strings.Contains(buf.String(), want) {
+		t.Errorf("DOT output does not contain %s:\n%s", want, buf.String())
+	}
+}
+
+func TestDowngradeError(t *testing.T) {
+	_, err := Bundle(context.Background(), Options{
+		Dir:      "testdata/downgrade/unlowerable",
+		TargetGo: "1.20",
+	})
+	var dgErr *DowngradeError
+	if !errors.As(err, &dgErr) {
+		t.Fatalf("Bundle() error = %v, want *DowngradeError", err)
+	}
+
+	want := []string{
+		"main.go:20:3: range over function requires go1.23 (return in loop body)",
+		"main.go:27:6: per-iteration loop variable requires go1.22 (captured and assigned in loop body)",
+		"main.go:31:32: package slices requires go1.21",
+	}
+	var got []string
+	for _, issue := range dgErr.Issues {
+		issue.Pos.Filename = filepath.Base(issue.Pos.Filename)
+		got = append(got, issue.String())
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Issues =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestInlineStd(t *testing.T) {
+	r, err := Bundle(context.Background(), Options{
+		Dir:       "testdata/src/inline-std",
+		TargetGo:  "1.20",
+		InlineStd: []string{"slices", "maps", "cmp", "iter"},
+	})
+	if err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+	checkGoVersion(t, r.Source, "go1.20")
+
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", r.Source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, spec := range file.Imports {
+		switch spec.Path.Value {
+		case `"slices"`, `"maps"`, `"cmp"`, `"iter"`:
+			t.Errorf("inlined package %s is imported", spec.Path.Value)
+		}
+	}
+	funcs := make(map[string]bool)
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			funcs[fn.Name.Name] = true
+		}
+	}
+	for name, want := range map[string]bool{
+		"slices_Sort":         true,
+		"maps_Keys":           true,
+		"cmp_Compare":         true,
+		"slices_BinarySearch": false,
+		"maps_Copy":           false,
+	} {
+		if funcs[name] != want {
+			t.Errorf("func %s bundled = %v, want %v", name, funcs[name], want)
+		}
+	}
+
+	if !slices.Contains(r.Packages, "slices") {
+		t.Errorf("Packages = %v, want slices among them", r.Packages)
+	}
+
+	_, err = Bundle(context.Background(), Options{
+		Dir:       "testdata/src/inline-std",
+		InlineStd: []string{"example.com/lib"},
+	})
+	if err == nil {
+		t.Errorf("Bundle() with non-std package succeeded")
+	}
+}
+
+func TestBundleResult(t *testing.T) {
+	r := bundleTestPackage(t, "single-deps")
+
+	const mainPath = "github.com/Atnuhs/go-bundler/bundler/testdata/src/single-deps"
+	if r.Package != mainPath {
+		t.Errorf("Package = %v, want %v", r.Package, mainPath)
+	}
+	wantPkgs := []string{mainPath, mainPath + "/lib"}
+	if !slices.Equal(r.Packages, wantPkgs) {
+		t.Errorf("Packages = %v, want %v", r.Packages, wantPkgs)
+	}
+	if got, want := len(r.Files), 2; got != want {
+		t.Errorf("len(Files) = %d, want %d", got, want)
+	}
+
+	wantLib := DeclCounts{Types: 3, Funcs: 3, Methods: 1, Consts: 2, Vars: 2}
+	if got := r.Decls[mainPath+"/lib"]; got != wantLib {
+		t.Errorf("Decls[lib] = %+v, want %+v", got, wantLib)
+	}
+
+	// every position comment agrees with the source map
+	parsed, err := ParseSourceMap(r.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(r.SourceMap.Entries, parsed.Entries) {
+		t.Errorf("SourceMap = %+v, want %+v", r.SourceMap.Entries, parsed.Entries)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	dir := filepath.Join("testdata/src", "downgrade")
+	r, err := Bundle(context.Background(), Options{Dir: dir, TargetGo: "1.20", Annotate: AnnotateLine})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(r.Source); err != nil {
+		t.Errorf("Check() error =\n%v", err)
+	}
+
+	// the directives agree with the source map, but name the files
+	parsed, err := ParseSourceMap(r.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Entries) != len(r.SourceMap.Entries) {
+		t.Fatalf("len(Entries) = %d, want %d", len(parsed.Entries), len(r.SourceMap.Entries))
+	}
+	for i, got := range parsed.Entries {
+		want := r.SourceMap.Entries[i]
+		if got.Start != want.Start || got.Line != want.Line || !filepath.IsAbs(got.File) || filepath.Base(got.File) != path.Base(want.File) {
+			t.Errorf("Entries[%d] = %+v, want %+v at an absolute path", i, got, want)
+		}
+	}
+
+	// generated declarations are mapped back to the bundled file
+	lines := strings.Split(string(r.Source), "\n")
+	found := false
+	for i, line := range lines {
+		if rest, ok := strings.CutPrefix(line, "//line "+bundledFile+":"); ok {
+			found = true
+			if rest != strconv.Itoa(i+2) {
+				t.Errorf("line %d: %s, want line %d", i+1, line, i+2)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no //line directive for generated declarations")
+	}
+
+	r, err = Bundle(context.Background(), Options{Dir: dir, Annotate: AnnotateNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed, err := ParseSourceMap(r.Source); err != nil || len(parsed.Entries) != 0 {
+		t.Errorf("ParseSourceMap() = %+v, %v, want no entries", parsed, err)
+	}
+	if len(r.SourceMap.Entries) == 0 {
+		t.Errorf("SourceMap is empty")
+	}
+
+	if _, err := Bundle(context.Background(), Options{Dir: dir, Annotate: "column"}); err == nil {
+		t.Errorf("Bundle() with unknown annotation succeeded")
+	}
+}
+
+func TestRemap(t *testing.T) {
+	r := bundleTestPackage(t, "single-deps")
+
+	var buf bytes.Buffer
+	if err := r.SourceMap.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadSourceMap(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(m.Entries, r.SourceMap.Entries) {
+		t.Fatalf("ReadSourceMap() = %+v, want %+v", m.Entries, r.SourceMap.Entries)
+	}
+
+	e := m.Entries[len(m.Entries)-1]
+	orig := fmt.Sprintf("%s:%d", e.File, e.Line+1)
+	tests := []struct {
+		text string
+		want string
+	}{
+		{
+			text: fmt.Sprintf("\t/judge/Main.go:%d +0x1d\n", e.Start+1),
+			want: "\t" + orig + " +0x1d\n",
+		},
+		{
+			text: fmt.Sprintf("./main.go:%d:5: undefined: x\n", e.Start+1),
+			want: orig + ": undefined: x\n",
+		},
+		{
+			// other files and lines outside of declarations are kept
+			text: "\t/usr/local/go/src/runtime/panic.go:115 +0x1d\n\tmain.go:1\n",
+			want: "\t/usr/local/go/src/runtime/panic.go:115 +0x1d\n\tmain.go:1\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := m.Remap(tt.text, "main.go"); got != tt.want {
+			t.Errorf("Remap(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	// traces of a build with //line directives point at the original
+	// main.go already
+	r, err = Bundle(context.Background(), Options{Dir: "testdata/src/single-deps", Annotate: AnnotateLine})
+	if err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+	parsed, err := ParseSourceMap(r.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := fmt.Sprintf("\t%s:%d +0x1d\n", filepath.Join(r.Dir, "main.go"), e.Start+1)
+	for _, m := range []*SourceMap{r.SourceMap, parsed} {
+		if !m.LineDirectives {
+			t.Errorf("LineDirectives = false, want true")
+		}
+		if got := m.Remap(text, "main.go"); got != text {
+			t.Errorf("Remap(%q) = %q, want it unchanged", text, got)
+		}
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	_, err := Bundle(context.Background(), Options{Dir: "testdata/errors"})
+	var loadErr *LoadError
+	if !errors.As(err, &loadErr) {
+		t.Fatalf("Bundle() error = %v, want *LoadError", err)
+	}
+
+	want := []struct {
+		file string
+		line int
+		msg  string
+	}{
+		{"lib.go", 4, "undefined: undefined"},
+		{"syntax.go", 3, "expected ')'"},
+	}
+	for _, w := range want {
+		found := false
+		for _, e := range loadErr.Errors {
+			if filepath.Base(e.Pos.Filename) == w.file && e.Pos.Line == w.line && strings.Contains(e.Msg, w.msg) {
+				found = true
+				if s := e.String(); !strings.HasPrefix(s, fmt.Sprintf("%s:%d:", e.Pos.Filename, w.line)) {
+					t.Errorf("String() = %q, want file:line: msg", s)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no error %s:%d: %s in\n%v", w.file, w.line, w.msg, err)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		goos string
+		want []string // file:line: construct, with the fallback if any
+	}{
+		{"default", nil, "linux", []string{
+			"add.s:0: assembly file add_purego.go",
+			"link.go:5: //go:linkname",
+		}},
+		{"purego", []string{"purego"}, "linux", []string{
+			"link.go:5: //go:linkname",
+		}},
+		{"file name", nil, "windows", []string{
+			"add.s:0: assembly file add_purego_windows.go",
+			"link.go:5: //go:linkname",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Bundle(context.Background(), Options{Dir: "testdata/unsupported", Tags: tt.tags, GOOS: tt.goos})
+			var unsupported *UnsupportedError
+			if !errors.As(err, &unsupported) {
+				t.Fatalf("Bundle() error = %v, want *UnsupportedError", err)
+			}
+			var got []string
+			for _, i := range unsupported.Issues {
+				s := fmt.Sprintf("%s:%d: %s", filepath.Base(i.Pos.Filename), i.Pos.Line, i.Construct)
+				if i.Fallback != "" {
+					s += " " + filepath.Base(i.Fallback)
+				}
+				got = append(got, s)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("issues = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbedFSUses(t *testing.T) {
+	_, err := Bundle(context.Background(), Options{Dir: "testdata/embedfs"})
+	var unsupported *UnsupportedError
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("Bundle() error = %v, want *UnsupportedError", err)
+	}
+	var got []string
+	for _, i := range unsupported.Issues {
+		got = append(got, fmt.Sprintf("%s:%d:%d", filepath.Base(i.Pos.Filename), i.Pos.Line, i.Pos.Column))
+	}
+	// the struct field and the parameter, not the inlined var
+	want := []string{"main.go:11:14", "res.go:9:19"}
+	if !slices.Equal(got, want) {
+		t.Errorf("issues = %q, want %q\n%v", got, want, err)
+	}
+}
+
+func TestParseErrorPos(t *testing.T) {
+	tests := []struct {
+		pos  string
+		want token.Position
+	}{
+		{"/a/b.go:3:7", token.Position{Filename: "/a/b.go", Line: 3, Column: 7}},
+		{"C:/a/b.go:3", token.Position{Filename: "C:/a/b.go", Line: 3}},
+		{"-", token.Position{}},
+		{"", token.Position{}},
+	}
+	for _, tt := range tests {
+		if got := parseErrorPos(tt.pos); got != tt.want {
+			t.Errorf("parseErrorPos(%q) = %+v, want %+v", tt.pos, got, tt.want)
+		}
+	}
+}
+
+func TestProfile(t *testing.T) {
+	dir := filepath.Join("testdata/src", "tags")
+	r, err := Bundle(context.Background(), Options{Dir: dir, Profile: "codeforces"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(r.Source, []byte(`return "windows"`)) {
+		t.Errorf("codeforces bundle does not use sys_windows.go:\n%s", r.Source)
+	}
+	if bytes.Contains(r.Source, []byte("debug: ")) {
+		t.Errorf("codeforces bundle uses debug.go:\n%s", r.Source)
+	}
+
+	// explicit settings win over the profile, tags are added
+	opts, err := applyProfile(Options{Profile: "atcoder", TargetGo: "1.21", Tags: []string{"debug"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.TargetGo != "1.21" || opts.GOOS != "linux" || opts.GOARCH != "amd64" || !slices.Equal(opts.Tags, []string{"atcoder", "debug"}) {
+		t.Errorf("applyProfile() = %+v", opts)
+	}
+
+	if _, err := Bundle(context.Background(), Options{Dir: dir, Profile: "judge"}); err == nil {
+		t.Errorf("Bundle() with unknown profile succeeded")
+	}
+}
+
+func TestStats(t *testing.T) {
+	r := bundleTestPackage(t, "groups")
+	st := r.Stats
+
+	if st.Total.Bytes != len(r.Source) || st.Total.Lines != bytes.Count(r.Source, []byte("\n")) {
+		t.Errorf("Total = %+v, want %d bytes, %d lines", st.Total, len(r.Source), bytes.Count(r.Source, []byte("\n")))
+	}
+	if len(st.Packages) != len(r.Packages) {
+		t.Fatalf("len(Packages) = %d, want %d", len(st.Packages), len(r.Packages))
+	}
+
+	sum := st.Other
+	for _, p := range st.Packages {
+		kinds := Size{}
+		for _, k := range []Size{p.Types, p.Funcs, p.Methods, p.Consts, p.Vars} {
+			kinds.add(k)
+		}
+		if kinds != p.Size {
+			t.Errorf("%s: Size = %+v, sum of kinds %+v", p.Package, p.Size, kinds)
+		}
+		if p.Reachable == 0 || p.Reachable > p.Total {
+			t.Errorf("%s: %d of %d declarations reachable", p.Package, p.Reachable, p.Total)
+		}
+		sum.add(p.Size)
+	}
+	if sum != st.Total {
+		t.Errorf("sum of packages and other = %+v, want %+v", sum, st.Total)
+	}
+
+	// the enum package only contributes its pruned const groups, a type
+	// and its methods
+	enum := st.Packages[1]
+	if enum.Consts.Bytes == 0 || enum.Funcs.Bytes != 0 || enum.Vars.Bytes != 0 {
+		t.Errorf("enum = %+v, want consts and no funcs or vars", enum)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	dir := "testdata/src/methods"
+	full := bundleTestPackage(t, "methods")
+
+	// fits as is
+	r, err := Bundle(context.Background(), Options{Dir: dir, MaxSize: len(full.Source)})
+	if err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+	if len(r.Compactions) != 0 || !bytes.Equal(r.Source, full.Source) {
+		t.Errorf("Compactions = %v, want none", r.Compactions)
+	}
+
+	// does not fit at all
+	_, err = Bundle(context.Background(), Options{Dir: dir, MaxSize: 1})
+	var sizeErr *SizeError
+	if !errors.As(err, &sizeErr) {
+		t.Fatalf("Bundle() error = %v, want *SizeError", err)
+	}
+	if len(sizeErr.Stats.Packages) != 2 || !strings.Contains(err.Error(), "/ds: ") {
+		t.Errorf("SizeError = %v, want a line per package", err)
+	}
+
+	// fits once compacted as much as possible
+	r, err = Bundle(context.Background(), Options{Dir: dir, MaxSize: sizeErr.Stats.Total.Bytes})
+	if err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+	want := []string{"drop position comments", "shorten prefixes", "strip blank lines"}
+	if !slices.Equal(r.Compactions, want) {
+		t.Errorf("Compactions = %v, want %v", r.Compactions, want)
+	}
+	if err := Check(r.Source); err != nil {
+		t.Errorf("Check() error =\n%v", err)
+	}
+	for _, s := range []string{"main_", "ds_", "\n\n", "// github.com"} {
+		if bytes.Contains(r.Source, []byte(s)) {
+			t.Errorf("compacted source contains %q:\n%s", s, r.Source)
+		}
+	}
+	if !bytes.HasPrefix(r.Source, []byte(generatedHeader)) {
+		t.Errorf("compacted source lost the generated header")
+	}
+}
+
+func TestEmbedSize(t *testing.T) {
+	_, err := Bundle(context.Background(), Options{Dir: "testdata/src/embed", MaxSize: 1})
+	var sizeErr *SizeError
+	if !errors.As(err, &sizeErr) {
+		t.Fatalf("Bundle() error = %v, want *SizeError", err)
+	}
+	var got []string
+	for _, e := range sizeErr.Embeds {
+		got = append(got, fmt.Sprintf("%s %v %d", e.Var, e.Files, e.Bytes))
+	}
+	want := []string{
+		"Greeting [greeting.txt] 18",
+		"Primes [primes.txt] 13",
+		"Names [my table.txt] 14",
+		"Data [data/a.txt data/b.txt] 26",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Embeds = %q, want %q", got, want)
+	}
+	if !strings.Contains(err.Error(), "table.Data embeds data/a.txt, data/b.txt: 26 bytes") {
+		t.Errorf("SizeError = %v, want a line per embedded var", err)
+	}
+}
+
+func TestMatchEmbedFile(t *testing.T) {
+	tests := []struct {
+		pattern, rel string
+		all          bool
+		want         bool
+	}{
+		{"a.txt", "a.txt", false, true},
+		{"*.txt", "a.txt", false, true},
+		{"*.txt", "d/a.txt", false, false},
+		{"d", "d/a.txt", false, true},
+		{"d", "d/e/a.txt", false, true},
+		{"d", "d/_e/a.txt", false, false},
+		{"d", "d/.a.txt", false, false},
+		{"d", "d/.a.txt", true, true},
+		{"d*", "dir/a.txt", false, true},
+		{"d", "dir/a.txt", false, false},
+	}
+	for _, tt := range tests {
+		if got := matchEmbedFile(tt.pattern, tt.rel, tt.all); got != tt.want {
+			t.Errorf("matchEmbedFile(%q, %q, %v) = %v, want %v", tt.pattern, tt.rel, tt.all, got, tt.want)
+		}
+	}
+}
+
+func TestBundleAll(t *testing.T) {
+	// a and b share lib, which each bundle renames on its own
+	results, err := BundleAll(context.Background(), Options{Dir: "testdata/batch", Patterns: []string{"./abc/..."}})
+	if err != nil {
+		t.Fatalf("BundleAll() error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("BundleAll() = %d results, want 2", len(results))
+	}
+	for _, r := range results {
+		if err := Check(r.Source); err != nil {
+			t.Errorf("%s: Check() error =\n%v\n%s", r.Package, err, r.Source)
+		}
+		for _, s := range []string{"func lib_Double(", "factor = 2"} {
+			if !bytes.Contains(r.Source, []byte(s)) {
+				t.Errorf("%s: source lacks %q:\n%s", r.Package, s, r.Source)
+			}
+		}
+	}
+}
+
+func TestEmbedArgs(t *testing.T) {
+	tests := []struct {
+		args    string
+		want    []string
+		wantErr bool
+	}{
+		{"a.txt  b/*.txt", []string{"a.txt", "b/*.txt"}, false},
+		{`"my table.txt" all:d`, []string{"my table.txt", "all:d"}, false},
+		{"`x y.txt`\t\"z\\u0020.txt\"", []string{"x y.txt", "z .txt"}, false},
+		{`"a.txt`, nil, true},
+		{`"a.txt"b`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := embedArgs(tt.args)
+		if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+			t.Errorf("embedArgs(%q) = %q, %v, want %q", tt.args, got, err, tt.want)
+		}
+	}
+}
+
+func TestMainPackages(t *testing.T) {
+	pkgs, err := loadPackages(context.Background(), Options{Dir: "testdata/batch", Patterns: []string{"./abc/..."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, p := range mainPackages(pkgs) {
+		got = append(got, p.PkgPath)
+	}
+	want := []string{
+		"github.com/Atnuhs/go-bundler/bundler/testdata/batch/abc/a",
+		"github.com/Atnuhs/go-bundler/bundler/testdata/batch/abc/b",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("mainPackages() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+package bundler
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// Diagnostic is an error found in a bundled file.
+type Diagnostic struct {
+	// Pos is the position in the bundled file.
+	Pos token.Position
+	// Orig is the position in the original sources, if known.
+	Orig token.Position
+	Msg  string
+}
+
+func (d Diagnostic) String() string {
+	if d.Orig.IsValid() {
+		return fmt.Sprintf("%s: %s (bundled %s)", d.Orig, d.Msg, d.Pos)
+	}
+	return fmt.Sprintf("%s: %s", d.Pos, d.Msg)
+}
+
+// CheckError is returned by Check when the bundled file does not compile.
+type CheckError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *CheckError) Error() string {
+	lines := make([]string, 0, len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Check parses and type-checks a bundled file. Errors are reported as a
+// *CheckError whose diagnostics are mapped back to the original sources using
+// the position comments or the //line directives of the file.
+func Check(src []byte) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		var list scanner.ErrorList
+		if !errors.As(err, &list) {
+			return err
+		}
+		diags := make([]Diagnostic, 0, len(list))
+		for _, e := range list {
+			diags = append(diags, Diagnostic{Pos: e.Pos, Msg: e.Msg})
+		}
+		return &CheckError{Diagnostics: diags}
+	}
+
+	diags := typeCheck(fset, file)
+	if len(diags) == 0 {
+		return nil
+	}
+
+	srcMap := sourceMapOf(fset, file)
+	for i, d := range diags {
+		if orig, ok := srcMap.Lookup(d.Pos.Line); ok {
+			diags[i].Orig = orig
+		}
+	}
+	return &CheckError{Diagnostics: diags}
+}
+
+func typeCheck(fset *token.FileSet, file *ast.File) []Diagnostic {
+	var diags []Diagnostic
+	conf := types.Config{
+		Importer: importer.Default(),
+		Error: func(err error) {
+			if e, ok := err.(types.Error); ok {
+				diags = append(diags, Diagnostic{Pos: e.Fset.PositionFor(e.Pos, false), Msg: e.Msg})
+				return
+			}
+			diags = append(diags, Diagnostic{Msg: err.Error()})
+		},
+	}
+	_, _ = conf.Check("main", fset, []*ast.File{file}, nil)
+	return diags
+}
@@ -0,0 +1,146 @@
+package bundler
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// clonePackages returns copies of main and of the packages it bundles, whose
+// syntax trees and type information can be edited without affecting other
+// bundles of the same loaded packages. External packages, which are never
+// edited, are shared.
+func clonePackages(main *packages.Package, external func(pkgPath) bool) *packages.Package {
+	clones := make(map[*packages.Package]*packages.Package)
+	var clone func(p *packages.Package) *packages.Package
+	clone = func(p *packages.Package) *packages.Package {
+		if c, ok := clones[p]; ok {
+			return c
+		}
+		if external(pkgPath(p.PkgPath)) {
+			clones[p] = p
+			return p
+		}
+		c := *p
+		clones[p] = &c
+		c.Imports = make(map[string]*packages.Package, len(p.Imports))
+		for path, imp := range p.Imports {
+			c.Imports[path] = clone(imp)
+		}
+
+		nodes := make(map[ast.Node]ast.Node)
+		c.Syntax = make([]*ast.File, len(p.Syntax))
+		for i, f := range p.Syntax {
+			c.Syntax[i] = cloneNode(f, nodes).(*ast.File)
+		}
+		if p.TypesInfo != nil {
+			c.TypesInfo = cloneInfo(p.TypesInfo, nodes)
+		}
+		return &c
+	}
+	return clone(main)
+}
+
+var (
+	nodeType   = reflect.TypeFor[ast.Node]()
+	objectType = reflect.TypeFor[*ast.Object]()
+	scopeType  = reflect.TypeFor[*ast.Scope]()
+)
+
+// cloneNode returns a deep copy of n, recording in nodes the copy of every
+// node it holds. The deprecated objects and scopes of the parser are shared.
+func cloneNode(n ast.Node, nodes map[ast.Node]ast.Node) ast.Node {
+	return cloneValue(reflect.ValueOf(n), nodes).Interface().(ast.Node)
+}
+
+func cloneValue(v reflect.Value, nodes map[ast.Node]ast.Node) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || v.Type() == objectType || v.Type() == scopeType {
+			return v
+		}
+		if n, ok := v.Interface().(ast.Node); ok {
+			if c, ok := nodes[n]; ok {
+				return reflect.ValueOf(c)
+			}
+		}
+		c := reflect.New(v.Type().Elem())
+		if v.Type().Implements(nodeType) {
+			nodes[v.Interface().(ast.Node)] = c.Interface().(ast.Node)
+		}
+		c.Elem().Set(cloneValue(v.Elem(), nodes))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(cloneValue(v.Elem(), nodes))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			c.Index(i).Set(cloneValue(v.Index(i), nodes))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := range v.NumField() {
+			c.Field(i).Set(cloneValue(v.Field(i), nodes))
+		}
+		return c
+	}
+	return v
+}
+
+// cloneInfo returns info keyed by the copies of its nodes. The objects and
+// types are shared.
+func cloneInfo(info *types.Info, nodes map[ast.Node]ast.Node) *types.Info {
+	c := &types.Info{
+		Types:        cloneMap(info.Types, nodes),
+		Instances:    cloneMap(info.Instances, nodes),
+		Defs:         cloneMap(info.Defs, nodes),
+		Uses:         cloneMap(info.Uses, nodes),
+		Implicits:    cloneMap(info.Implicits, nodes),
+		Selections:   cloneMap(info.Selections, nodes),
+		Scopes:       cloneMap(info.Scopes, nodes),
+		FileVersions: cloneMap(info.FileVersions, nodes),
+	}
+	for _, in := range info.InitOrder {
+		c.InitOrder = append(c.InitOrder, &types.Initializer{
+			Lhs: in.Lhs,
+			Rhs: mapNode(in.Rhs, nodes),
+		})
+	}
+	return c
+}
+
+// nodeKey is a node type keying the maps of types.Info.
+type nodeKey interface {
+	ast.Node
+	comparable
+}
+
+func cloneMap[K nodeKey, V any](m map[K]V, nodes map[ast.Node]ast.Node) map[K]V {
+	if m == nil {
+		return nil
+	}
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[mapNode(k, nodes)] = v
+	}
+	return c
+}
+
+// mapNode returns the copy of n, or n itself if it was not copied.
+func mapNode[N ast.Node](n N, nodes map[ast.Node]ast.Node) N {
+	if c, ok := nodes[n].(N); ok {
+		return c
+	}
+	return n
+}
@@ -0,0 +1,316 @@
+package bundler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// SizeError is returned when the bundled source does not fit
+// Options.MaxSize even after every compaction.
+type SizeError struct {
+	Limit int
+	// Stats are the sizes of the compacted source.
+	Stats Stats
+	// Embeds are the literals of the bundled //go:embed vars, counted in the
+	// sizes of their packages.
+	Embeds []EmbedSize
+}
+
+func (e *SizeError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "bundle is %d bytes, over the limit of %d bytes", e.Stats.Total.Bytes, e.Limit)
+	for _, p := range e.Stats.Packages {
+		fmt.Fprintf(&sb, "\n\t%s: %d bytes", p.Package, p.Size.Bytes)
+	}
+	fmt.Fprintf(&sb, "\n\tother: %d bytes", e.Stats.Other.Bytes)
+	for _, em := range e.Embeds {
+		fmt.Fprintf(&sb, "\n\t%s.%s embeds %s: %d bytes", em.Package, em.Var, strings.Join(em.Files, ", "), em.Bytes)
+	}
+	return sb.String()
+}
+
+// compaction is a size reduction of the formatted bundled source.
+type compaction struct {
+	name  string
+	apply func(b *Bundler, src []byte) ([]byte, error)
+}
+
+// compactions are applied in order until the source fits, from the ones
+// losing the least information.
+var compactions = []compaction{
+	{"drop position comments", (*Bundler).dropPosComments},
+	{"drop comments", (*Bundler).dropComments},
+	{"shorten prefixes", (*Bundler).shortenPrefixes},
+	{"strip blank lines", (*Bundler).stripBlankLines},
+}
+
+// fitSize applies compactions to src until it is at most opts.MaxSize bytes
+// and returns the names of those applied.
+func (b *Bundler) fitSize(src []byte) ([]byte, []string, error) {
+	limit := b.opts.MaxSize
+	var applied []string
+	for _, c := range compactions {
+		if len(src) <= limit {
+			return src, applied, nil
+		}
+		compacted, err := c.apply(b, src)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+		if len(compacted) < len(src) {
+			src = compacted
+			applied = append(applied, c.name)
+		}
+	}
+	if len(src) <= limit {
+		return src, applied, nil
+	}
+
+	stats, err := b.stats(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, nil, &SizeError{Limit: limit, Stats: stats, Embeds: b.embedSizes()}
+}
+
+// dropPosComments removes the position comments and //line directives of
+// the declarations.
+func (b *Bundler) dropPosComments(src []byte) ([]byte, error) {
+	return filterComments(src, func(c *ast.Comment) bool {
+		return !posComment.MatchString(c.Text) && !lineDirective.MatchString(c.Text)
+	})
+}
+
+// dropComments removes every comment but the generated header, which marks
+// the file as written by go-bundler.
+func (b *Bundler) dropComments(src []byte) ([]byte, error) {
+	return filterComments(src, func(c *ast.Comment) bool {
+		return c.Text == generatedHeader
+	})
+}
+
+// filterComments keeps the comments of src for which keep returns true.
+func filterComments(src []byte, keep func(*ast.Comment) bool) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	comments := file.Comments[:0]
+	for _, g := range file.Comments {
+		list := g.List[:0]
+		for _, c := range g.List {
+			if keep(c) {
+				list = append(list, c)
+			}
+		}
+		if len(list) > 0 {
+			g.List = list
+			comments = append(comments, g)
+		}
+	}
+	file.Comments = comments
+	return printFile(fset, file)
+}
+
+// shortenPrefixes replaces the package prefixes of the bundled declarations
+// with the shortest ones that no identifier of src starts with. Renaming
+// follows the type-checked uses, so that locals named like a declaration are
+// left alone.
+func (b *Bundler) shortenPrefixes(src []byte) ([]byte, error) {
+	fset, file, info, err := checkFile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	// declarations of each package in the bundle
+	declPkgs := make(map[string]pkgPath)
+	for _, decl := range b.bundled.Decls {
+		pp, ok := b.declPkg(decl)
+		if !ok {
+			continue
+		}
+		for _, name := range declNames(decl) {
+			declPkgs[name] = pp
+		}
+	}
+
+	used := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			used[id.Name] = true
+		}
+		return true
+	})
+	free := func(prefix string) bool {
+		for name := range used {
+			if strings.HasPrefix(name, prefix+"_") {
+				return false
+			}
+		}
+		return true
+	}
+
+	short := make(map[pkgPath]string, len(b.topoPkgs))
+	next := 0
+	for _, pkg := range b.topoPkgs {
+		pp := pkgPath(pkg.PkgPath)
+		for {
+			prefix := shortName(next)
+			if len(prefix) >= len(b.prefixes[pp]) {
+				break
+			}
+			next++
+			if free(prefix) {
+				short[pp] = prefix
+				break
+			}
+		}
+	}
+
+	rename := func(id *ast.Ident, obj types.Object) {
+		if obj == nil || obj.Pkg() == nil || obj.Pkg().Path() != "main" {
+			return
+		}
+		if v, ok := obj.(*types.Var); ok && v.IsField() && !v.Embedded() {
+			return
+		}
+		if obj.Parent() != obj.Pkg().Scope() && !isEmbedded(obj) {
+			return
+		}
+		pp, ok := declPkgs[obj.Name()]
+		prefix, shortened := short[pp]
+		if !ok || !shortened {
+			return
+		}
+		// main and init keep their names
+		if rest, ok := strings.CutPrefix(obj.Name(), string(b.prefixes[pp])+"_"); ok {
+			id.Name = prefix + "_" + rest
+		}
+	}
+	for id, obj := range info.Defs {
+		rename(id, obj)
+	}
+	for id, obj := range info.Uses {
+		rename(id, obj)
+	}
+	return printFile(fset, file)
+}
+
+// isEmbedded reports whether obj is an embedded field, named like the type.
+func isEmbedded(obj types.Object) bool {
+	v, ok := obj.(*types.Var)
+	return ok && v.Embedded()
+}
+
+// shortName returns the n-th of a, b, ..., z, aa, ab, ...
+func shortName(n int) string {
+	var name []byte
+	for n++; n > 0; n = (n - 1) / 26 {
+		name = append([]byte{byte('a' + (n-1)%26)}, name...)
+	}
+	return string(name)
+}
+
+// declNames returns the names declared by a top-level declaration.
+func declNames(decl ast.Decl) []string {
+	var names []string
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv == nil {
+			names = append(names, d.Name.Name)
+		}
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				names = append(names, s.Name.Name)
+			case *ast.ValueSpec:
+				for _, name := range s.Names {
+					names = append(names, name.Name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// stripBlankLines removes the blank lines of src outside raw string
+// literals.
+func (b *Bundler) stripBlankLines(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var raws [][2]int
+	ast.Inspect(file, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING && lit.Value[0] == '`' {
+			raws = append(raws, [2]int{fset.Position(lit.Pos()).Offset, fset.Position(lit.End()).Offset})
+		}
+		return true
+	})
+	inRaw := func(off int) bool {
+		for _, r := range raws {
+			if r[0] <= off && off < r[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var buf bytes.Buffer
+	for off := 0; off < len(src); {
+		end := bytes.IndexByte(src[off:], '\n')
+		if end < 0 {
+			end = len(src)
+		} else {
+			end += off + 1
+		}
+		line := src[off:end]
+		if len(bytes.TrimSpace(line)) > 0 || inRaw(off) {
+			buf.Write(line)
+		}
+		off = end
+	}
+	return buf.Bytes(), nil
+}
+
+// checkFile parses and type-checks a bundled file.
+func checkFile(src []byte) (*token.FileSet, *ast.File, *types.Info, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	info := &types.Info{
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+	}
+	var errs []error
+	conf := types.Config{
+		Importer: importer.Default(),
+		Error:    func(err error) { errs = append(errs, err) },
+	}
+	_, _ = conf.Check("main", fset, []*ast.File{file}, info)
+	if len(errs) > 0 {
+		return nil, nil, nil, errors.Join(errs...)
+	}
+	return fset, file, info, nil
+}
+
+func printFile(fset *token.FileSet, file *ast.File) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
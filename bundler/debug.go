@@ -0,0 +1,234 @@
+package bundler
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"slices"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// debugDirective marks a function, such as a pretty-printer, whose calls are
+// removed from the bundle.
+const debugDirective = "//bundler:debug"
+
+// stripDebug removes from the syntax of the bundled packages the statements
+// calling a function marked with debugDirective and the if statements whose
+// condition is constant false, such as if debug with a const debug set to
+// false by the build tags of the judge. It runs before the reachability
+// analysis, so that what only debug code uses is not bundled either.
+//
+// Locals whose only uses are removed would no longer compile, so they are
+// kept used by a blank assignment. Labels whose only branches are removed
+// are dropped.
+func (b *Bundler) stripDebug() {
+	marked := make(map[types.Object]bool)
+	for _, pkg := range b.topoPkgs {
+		for _, f := range pkg.Syntax {
+			for _, decl := range f.Decls {
+				if fd, ok := decl.(*ast.FuncDecl); ok && hasDirective(fd.Doc, debugDirective) {
+					if obj := pkg.TypesInfo.Defs[fd.Name]; obj != nil {
+						marked[obj] = true
+					}
+				}
+			}
+		}
+	}
+
+	for _, pkg := range b.topoPkgs {
+		s := &debugStripper{info: pkg.TypesInfo, marked: marked}
+		for _, f := range pkg.Syntax {
+			for _, decl := range f.Decls {
+				s.strip(decl)
+			}
+		}
+	}
+}
+
+// debugStripper removes the debug code of one package.
+type debugStripper struct {
+	info   *types.Info
+	marked map[types.Object]bool
+}
+
+// strip removes the debug code of decl.
+func (s *debugStripper) strip(decl ast.Decl) {
+	// the removed parts of decl
+	var removed []ast.Node
+	ast.Inspect(decl, func(n ast.Node) bool {
+		if stmt, ok := n.(ast.Stmt); ok && s.isDebugCall(stmt) {
+			removed = append(removed, stmt)
+			return false
+		}
+		if ifs, ok := n.(*ast.IfStmt); ok && s.isDeadIf(ifs) {
+			removed = append(removed, ifs.Cond, ifs.Body)
+		}
+		return true
+	})
+	if len(removed) == 0 {
+		return
+	}
+
+	// locals used outside of the removed parts stay used
+	used := make(map[types.Object]bool)
+	assigned := make(map[*ast.Ident]bool)
+	ast.Inspect(decl, func(n ast.Node) bool {
+		if slices.Contains(removed, n) {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			// assigning is not using
+			if n.Tok == token.ASSIGN || n.Tok == token.DEFINE {
+				for _, lhs := range n.Lhs {
+					if id, ok := lhs.(*ast.Ident); ok {
+						assigned[id] = true
+					}
+				}
+			}
+		case *ast.Ident:
+			if obj := s.info.Uses[n]; obj != nil && !assigned[n] {
+				used[obj] = true
+			}
+		}
+		return true
+	})
+
+	// blankUses returns blank assignments of the locals declared outside of
+	// part and only used in it
+	blankUses := func(part ast.Node) []ast.Stmt {
+		var stmts []ast.Stmt
+		ast.Inspect(part, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			v, ok := s.info.Uses[id].(*types.Var)
+			if !ok || used[v] || v.IsField() || v.Pkg() == nil || v.Parent() == v.Pkg().Scope() {
+				return true
+			}
+			if part.Pos() <= v.Pos() && v.Pos() < part.End() {
+				return true
+			}
+			used[v] = true
+			stmts = append(stmts, &ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent("_")},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{id},
+			})
+			return true
+		})
+		return stmts
+	}
+
+	var pre func(c *astutil.Cursor) bool
+	// kept returns the else branch of a removed if statement, stripped too
+	kept := func(els ast.Stmt) []ast.Stmt {
+		if els == nil {
+			return nil
+		}
+		return []ast.Stmt{astutil.Apply(els, pre, nil).(ast.Stmt)}
+	}
+	pre = func(c *astutil.Cursor) bool {
+		stmt, ok := c.Node().(ast.Stmt)
+		if !ok {
+			return true
+		}
+		if ifs, ok := stmt.(*ast.IfStmt); ok {
+			// dead else if branches
+			for {
+				elif, ok := ifs.Else.(*ast.IfStmt)
+				if !ok || !s.isDeadIf(elif) {
+					break
+				}
+				if stmts := append(blankUses(elif.Cond), blankUses(elif.Body)...); len(stmts) > 0 {
+					ifs.Else = &ast.BlockStmt{Lbrace: elif.Pos(), List: append(stmts, kept(elif.Else)...)}
+					break
+				}
+				ifs.Else = elif.Else
+			}
+		}
+
+		var stmts []ast.Stmt
+		if ifs, ok := stmt.(*ast.IfStmt); ok && s.isDeadIf(ifs) {
+			stmts = append(blankUses(ifs.Cond), blankUses(ifs.Body)...)
+			stmts = append(stmts, kept(ifs.Else)...)
+		} else if s.isDebugCall(stmt) {
+			stmts = blankUses(stmt)
+		} else {
+			return true
+		}
+		if c.Index() < 0 {
+			// not in a statement list, such as the statement of a label
+			c.Replace(&ast.BlockStmt{Lbrace: stmt.Pos(), List: stmts, Rbrace: stmt.Pos()})
+			return false
+		}
+		for _, st := range stmts {
+			c.InsertBefore(st)
+		}
+		c.Delete()
+		return false
+	}
+	astutil.Apply(decl, pre, nil)
+
+	// labels whose branches were all removed would no longer compile
+	branched := make(map[types.Object]bool)
+	ast.Inspect(decl, func(n ast.Node) bool {
+		if br, ok := n.(*ast.BranchStmt); ok && br.Label != nil {
+			branched[s.info.Uses[br.Label]] = true
+		}
+		return true
+	})
+	astutil.Apply(decl, nil, func(c *astutil.Cursor) bool {
+		if ls, ok := c.Node().(*ast.LabeledStmt); ok && !branched[s.info.Defs[ls.Label]] {
+			c.Replace(ls.Stmt)
+		}
+		return true
+	})
+}
+
+// isDebugCall reports whether stmt calls, defers or starts a function marked
+// as debug.
+func (s *debugStripper) isDebugCall(stmt ast.Stmt) bool {
+	var call *ast.CallExpr
+	switch st := stmt.(type) {
+	case *ast.ExprStmt:
+		call, _ = st.X.(*ast.CallExpr)
+	case *ast.DeferStmt:
+		call = st.Call
+	case *ast.GoStmt:
+		call = st.Call
+	}
+	if call == nil {
+		return false
+	}
+	callee := typeutil.Callee(s.info, call)
+	return callee != nil && s.marked[origin(callee)]
+}
+
+// isDeadIf reports whether the body of ifs never runs: its condition is
+// constant false. If statements with an init statement are kept, since it
+// runs anyway.
+func (s *debugStripper) isDeadIf(ifs *ast.IfStmt) bool {
+	if ifs.Init != nil {
+		return false
+	}
+	v := s.info.Types[ifs.Cond].Value
+	return v != nil && v.Kind() == constant.Bool && !constant.BoolVal(v)
+}
+
+// hasDirective reports whether doc holds the comment directive.
+func hasDirective(doc *ast.CommentGroup, directive string) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if c.Text == directive {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,883 @@
+package bundler
+
+import (
+	"cmp"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"go/version"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Go versions that introduced the constructs lowered by downgrade.
+const (
+	goGenerics  = "go1.18"
+	goBuiltins  = "go1.21" // min, max and clear
+	goRangeInt  = "go1.22" // also per-iteration loop variables
+	goRangeFunc = "go1.23"
+)
+
+// stdSince lists std packages added after go1.18 with the version adding them.
+var stdSince = map[string]string{
+	"cmp":              "go1.21",
+	"log/slog":         "go1.21",
+	"maps":             "go1.21",
+	"slices":           "go1.21",
+	"testing/slogtest": "go1.21",
+	"go/version":       "go1.22",
+	"math/rand/v2":     "go1.22",
+	"iter":             "go1.23",
+	"structs":          "go1.23",
+	"unique":           "go1.23",
+	"crypto/hkdf":      "go1.24",
+	"crypto/mlkem":     "go1.24",
+	"crypto/pbkdf2":    "go1.24",
+	"crypto/sha3":      "go1.24",
+	"weak":             "go1.24",
+}
+
+// DowngradeIssue is a construct that could not be lowered to the target Go
+// version.
+type DowngradeIssue struct {
+	// Pos is the position in the original sources.
+	Pos       token.Position
+	Construct string
+	// Version is the Go version the construct requires.
+	Version string
+	Reason  string
+}
+
+func (i DowngradeIssue) String() string {
+	s := fmt.Sprintf("%s: %s requires %s", i.Pos, i.Construct, i.Version)
+	if i.Reason != "" {
+		s += " (" + i.Reason + ")"
+	}
+	return s
+}
+
+// DowngradeError is returned when a bundle uses constructs that cannot be
+// lowered to the target Go version.
+type DowngradeError struct {
+	Target string
+	Issues []DowngradeIssue
+}
+
+func (e *DowngradeError) Error() string {
+	lines := make([]string, 0, len(e.Issues)+1)
+	lines = append(lines, fmt.Sprintf("cannot lower to %s:", e.Target))
+	for _, i := range e.Issues {
+		lines = append(lines, "\t"+i.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// downgrader rewrites constructs of newer Go versions in the bundled file into
+// equivalents the target version accepts. It works on the bundled file before
+// prefixes are applied, so that type information of the original packages is
+// available.
+type downgrader struct {
+	b      *Bundler
+	target string
+
+	// cache
+	versions map[string]string // go version by file name
+	names    map[string]bool   // identifiers used in the file
+	helpers  map[string]bool   // helper decls to add
+
+	// output
+	issues []DowngradeIssue
+	err    error
+}
+
+func (b *Bundler) downgrade(file *ast.File, target string) error {
+	if !strings.HasPrefix(target, "go") {
+		target = "go" + target
+	}
+	if !version.IsValid(target) {
+		return fmt.Errorf("invalid target Go version %q", target)
+	}
+
+	d := &downgrader{
+		b:        b,
+		target:   target,
+		versions: make(map[string]string),
+		names:    make(map[string]bool),
+		helpers:  make(map[string]bool),
+	}
+	for _, pkg := range b.topoPkgs {
+		for _, f := range pkg.Syntax {
+			v := pkg.TypesInfo.FileVersions[f]
+			if v == "" && pkg.Module != nil {
+				v = "go" + pkg.Module.GoVersion
+			}
+			d.versions[pkg.Fset.Position(f.Pos()).Filename] = v
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			d.names[id.Name] = true
+		}
+		return true
+	})
+
+	d.checkGenerics(file)
+	d.checkStdPackages(file)
+	astutil.Apply(file, nil, d.post)
+	if d.err != nil {
+		return d.err
+	}
+	if err := d.addHelpers(file); err != nil {
+		return err
+	}
+
+	if len(d.issues) > 0 {
+		slices.SortStableFunc(d.issues, func(a, b DowngradeIssue) int {
+			return cmp.Or(
+				strings.Compare(a.Pos.Filename, b.Pos.Filename),
+				cmp.Compare(a.Pos.Line, b.Pos.Line),
+				cmp.Compare(a.Pos.Column, b.Pos.Column),
+			)
+		})
+		return &DowngradeError{Target: target, Issues: d.issues}
+	}
+	return nil
+}
+
+func (d *downgrader) below(v string) bool {
+	return version.Compare(d.target, v) < 0
+}
+
+func (d *downgrader) issue(n ast.Node, construct, v, reason string) {
+	d.issues = append(d.issues, DowngradeIssue{
+		Pos:       d.b.mainPkg.Fset.Position(n.Pos()),
+		Construct: construct,
+		Version:   v,
+		Reason:    reason,
+	})
+}
+
+// fresh returns an identifier name based on base that is not used in the file.
+func (d *downgrader) fresh(base string) string {
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("%s%d", base, i)
+		if !d.names[name] {
+			d.names[name] = true
+			return name
+		}
+	}
+}
+
+// typeExpr returns the type expression of t positioned at pos, so that the
+// printer keeps it on the line of the rewritten statement.
+func (d *downgrader) typeExpr(t types.Type, pos token.Pos) ast.Expr {
+	expr, err := d.b.typeExpr(t)
+	if err != nil {
+		if d.err == nil {
+			d.err = err
+		}
+		return expr
+	}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch v := n.(type) {
+		case *ast.Ident:
+			v.NamePos = pos
+		case *ast.StarExpr:
+			v.Star = pos
+		case *ast.ArrayType:
+			v.Lbrack = pos
+		case *ast.MapType:
+			v.Map = pos
+		case *ast.ChanType:
+			v.Begin = pos
+		case *ast.FuncType:
+			v.Func = pos
+		case *ast.StructType:
+			v.Struct = pos
+		case *ast.InterfaceType:
+			v.Interface = pos
+		case *ast.IndexExpr:
+			v.Lbrack, v.Rbrack = pos, pos
+		case *ast.IndexListExpr:
+			v.Lbrack, v.Rbrack = pos, pos
+		case *ast.FieldList:
+			v.Opening, v.Closing = pos, pos
+		}
+		return true
+	})
+	return expr
+}
+
+func (d *downgrader) checkGenerics(file *ast.File) {
+	if !d.below(goGenerics) {
+		return
+	}
+	for _, decl := range file.Decls {
+		switch v := decl.(type) {
+		case *ast.FuncDecl:
+			if v.Type.TypeParams != nil {
+				d.issue(v, "generic function", goGenerics, "")
+			}
+		case *ast.GenDecl:
+			for _, spec := range v.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok && ts.TypeParams != nil {
+					d.issue(ts, "generic type", goGenerics, "")
+				}
+			}
+		}
+	}
+}
+
+func (d *downgrader) checkStdPackages(file *ast.File) {
+	reported := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		_, info, ok := d.b.infoOfNode(x)
+		if !ok {
+			return true
+		}
+		pn, ok := info.Uses[x].(*types.PkgName)
+		if !ok {
+			return true
+		}
+		path := pn.Imported().Path()
+		if v, ok := stdSince[path]; ok && d.below(v) && d.b.isExternal(pkgPath(path)) && !reported[path] {
+			reported[path] = true
+			d.issue(sel, "package "+path, v, "")
+		}
+		return true
+	})
+}
+
+func (d *downgrader) post(c *astutil.Cursor) bool {
+	switch n := c.Node().(type) {
+	case *ast.LabeledStmt:
+		if r, ok := n.Stmt.(*ast.RangeStmt); ok {
+			if stmt, ok := d.lowerRange(r, n.Label); ok {
+				if _, isCall := stmt.(*ast.ExprStmt); isCall {
+					// the label has no loop left to refer to
+					c.Replace(stmt)
+				} else {
+					n.Stmt = stmt
+				}
+			}
+		}
+	case *ast.RangeStmt:
+		if _, ok := c.Parent().(*ast.LabeledStmt); ok {
+			// lowered together with its label
+			break
+		}
+		if stmt, ok := d.lowerRange(n, nil); ok {
+			c.Replace(stmt)
+		}
+	case *ast.ForStmt:
+		d.lowerForLoopVars(n)
+	case *ast.CallExpr:
+		d.lowerBuiltin(c, n)
+	}
+	return true
+}
+
+func (d *downgrader) lowerRange(r *ast.RangeStmt, label *ast.Ident) (ast.Stmt, bool) {
+	_, info, ok := d.b.infoOfNode(r)
+	if !ok {
+		return nil, false
+	}
+	tv, ok := info.Types[r.X]
+	if !ok {
+		return nil, false
+	}
+
+	switch u := coreType(tv.Type).(type) {
+	case *types.Basic:
+		if u.Info()&types.IsInteger != 0 {
+			if !d.below(goRangeInt) {
+				return nil, false
+			}
+			return d.lowerRangeInt(info, r, tv), true
+		}
+	case *types.Signature:
+		if !d.below(goRangeFunc) {
+			return nil, false
+		}
+		return d.lowerRangeFunc(r, u, label)
+	}
+
+	if r.Tok == token.DEFINE {
+		d.copyLoopVars(info, r, r.Body, nil, r.Key, r.Value)
+	}
+	return nil, false
+}
+
+// lowerRangeInt rewrites
+//
+//	for k := range n { body }
+//
+// into
+//
+//	for i0, n0 := T(0), n; i0 < n0; i0++ { k := i0; body }
+//
+// which keeps n evaluated once and k per iteration.
+func (d *downgrader) lowerRangeInt(info *types.Info, r *ast.RangeStmt, tv types.TypeAndValue) ast.Stmt {
+	typ := tv.Type
+	if isUntyped(typ) {
+		typ = types.Typ[types.Int]
+		if r.Tok == token.ASSIGN && r.Key != nil {
+			typ = info.TypeOf(r.Key)
+		}
+	}
+	// synthesized nodes take the position of the loop to keep it on one line
+	pos := r.For
+	conv := func(e ast.Expr) ast.Expr {
+		if types.Identical(typ, types.Typ[types.Int]) {
+			return e
+		}
+		return &ast.CallExpr{Fun: d.typeExpr(typ, pos), Lparen: pos, Args: []ast.Expr{e}, Rparen: pos}
+	}
+	i, n := d.fresh("i"), d.fresh("n")
+	limit := r.X
+	if tv.Value != nil {
+		// n0 must not default to int
+		limit = conv(limit)
+	}
+	loop := &ast.ForStmt{
+		For: r.For,
+		Init: &ast.AssignStmt{
+			Lhs: []ast.Expr{identAt(i, pos), identAt(n, pos)},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{conv(&ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: "0"}), limit},
+		},
+		Cond: &ast.BinaryExpr{X: identAt(i, pos), Op: token.LSS, Y: identAt(n, pos)},
+		Post: &ast.IncDecStmt{X: identAt(i, pos), Tok: token.INC},
+		Body: r.Body,
+	}
+	if r.Key != nil && !isBlank(r.Key) {
+		tok := r.Tok
+		loop.Body.List = slices.Insert(loop.Body.List, 0, ast.Stmt(&ast.AssignStmt{
+			Lhs: []ast.Expr{r.Key},
+			Tok: tok,
+			Rhs: []ast.Expr{identAt(i, r.Body.Lbrace)},
+		}))
+	}
+	return loop
+}
+
+// lowerRangeFunc rewrites
+//
+//	for k, v := range seq { body }
+//
+// into
+//
+//	seq(func(k K, v V) bool { body; return true })
+//
+// where continue returns true and break returns false. Bodies which return
+// from, defer in or jump out of the enclosing function cannot be lowered.
+func (d *downgrader) lowerRangeFunc(r *ast.RangeStmt, sig *types.Signature, label *ast.Ident) (ast.Stmt, bool) {
+	if sig.Params().Len() != 1 {
+		return nil, false
+	}
+	yield, ok := coreType(sig.Params().At(0).Type()).(*types.Signature)
+	if !ok {
+		return nil, false
+	}
+	if !d.rewriteYieldBody(r.Body, label) {
+		return nil, false
+	}
+
+	pos, tokPos := r.For, r.TokPos
+	if !tokPos.IsValid() {
+		tokPos = pos
+	}
+	fn := &ast.FuncLit{
+		Type: &ast.FuncType{
+			Func:    pos,
+			Params:  &ast.FieldList{Opening: pos, Closing: tokPos},
+			Results: &ast.FieldList{List: []*ast.Field{{Type: identAt("bool", tokPos)}}},
+		},
+		Body: &ast.BlockStmt{Lbrace: r.Body.Lbrace, Rbrace: r.Body.Rbrace},
+	}
+	vars := []ast.Expr{r.Key, r.Value}
+	for i := 0; i < yield.Params().Len(); i++ {
+		name := identAt("_", tokPos)
+		if i < len(vars) && vars[i] != nil && !isBlank(vars[i]) {
+			if r.Tok == token.DEFINE {
+				name = vars[i].(*ast.Ident)
+			} else {
+				name = identAt(d.fresh("v"), tokPos)
+				fn.Body.List = append(fn.Body.List, &ast.AssignStmt{
+					Lhs: []ast.Expr{vars[i]},
+					Tok: token.ASSIGN,
+					Rhs: []ast.Expr{identAt(name.Name, r.Body.Lbrace)},
+				})
+			}
+		}
+		fn.Type.Params.List = append(fn.Type.Params.List, &ast.Field{
+			Names: []*ast.Ident{name},
+			Type:  d.typeExpr(yield.Params().At(i).Type(), tokPos),
+		})
+	}
+	fn.Body.List = append(fn.Body.List, r.Body.List...)
+	fn.Body.List = append(fn.Body.List, &ast.ReturnStmt{
+		Return:  r.Body.Rbrace,
+		Results: []ast.Expr{identAt("true", r.Body.Rbrace)},
+	})
+
+	return &ast.ExprStmt{X: &ast.CallExpr{
+		Fun:    r.X,
+		Lparen: r.X.End(),
+		Args:   []ast.Expr{fn},
+		Rparen: r.Body.Rbrace,
+	}}, true
+}
+
+// rewriteYieldBody turns the branch statements of a range-over-func body into
+// returns of the yield function. It reports false if the body cannot be
+// lowered.
+func (d *downgrader) rewriteYieldBody(body *ast.BlockStmt, label *ast.Ident) bool {
+	// labels declared inside the body may be jumped to freely
+	inner := make(map[string]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		if l, ok := n.(*ast.LabeledStmt); ok {
+			inner[l.Label.Name] = true
+		}
+		_, isLit := n.(*ast.FuncLit)
+		return !isLit
+	})
+
+	ok := true
+	fail := func(n ast.Node, reason string) {
+		ok = false
+		d.issue(n, "range over function", goRangeFunc, reason)
+	}
+	ret := func(v string, pos token.Pos) *ast.ReturnStmt {
+		return &ast.ReturnStmt{Return: pos, Results: []ast.Expr{identAt(v, pos)}}
+	}
+
+	loops, breakables := 0, 0
+	pre := func(c *astutil.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ForStmt, *ast.RangeStmt:
+			loops++
+			breakables++
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			breakables++
+		case *ast.ReturnStmt:
+			fail(n, "return in loop body")
+		case *ast.DeferStmt:
+			fail(n, "defer in loop body")
+		case *ast.BranchStmt:
+			own := n.Label != nil && label != nil && n.Label.Name == label.Name
+			switch {
+			case n.Tok == token.GOTO:
+				if !inner[n.Label.Name] {
+					fail(n, "goto out of loop body")
+				}
+			case n.Tok == token.FALLTHROUGH:
+			case n.Label != nil && !own:
+				if !inner[n.Label.Name] {
+					fail(n, "labeled "+n.Tok.String()+" out of loop body")
+				}
+			case n.Tok == token.CONTINUE && (own || loops == 0):
+				c.Replace(ret("true", n.Pos()))
+			case n.Tok == token.BREAK && (own || breakables == 0):
+				c.Replace(ret("false", n.Pos()))
+			}
+		}
+		return true
+	}
+	post := func(c *astutil.Cursor) bool {
+		switch c.Node().(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			loops--
+			breakables--
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			breakables--
+		}
+		return true
+	}
+	astutil.Apply(body, pre, post)
+	return ok
+}
+
+// lowerForLoopVars gives the variables of a three-clause loop one copy per
+// iteration as in go1.22, where they are captured by closures or pointers.
+func (d *downgrader) lowerForLoopVars(f *ast.ForStmt) {
+	init, ok := f.Init.(*ast.AssignStmt)
+	if !ok || init.Tok != token.DEFINE {
+		return
+	}
+	_, info, ok := d.b.infoOfNode(f)
+	if !ok {
+		return
+	}
+	d.copyLoopVars(info, f, f.Body, f.Post, init.Lhs...)
+}
+
+func (d *downgrader) copyLoopVars(info *types.Info, loop ast.Node, body *ast.BlockStmt, post ast.Stmt, vars ...ast.Expr) {
+	if !d.below(goRangeInt) {
+		return
+	}
+	fileVersion := d.versions[d.b.mainPkg.Fset.Position(loop.Pos()).Filename]
+	if fileVersion == "" || version.Compare(fileVersion, goRangeInt) < 0 {
+		// the loop already has a single variable
+		return
+	}
+
+	var copies []ast.Stmt
+	for _, v := range vars {
+		id, ok := v.(*ast.Ident)
+		if !ok || isBlank(id) {
+			continue
+		}
+		obj := info.Defs[id]
+		if obj == nil || !isCaptured(info, body, obj) {
+			continue
+		}
+		if post != nil && isAssigned(info, body, obj) {
+			d.issue(id, "per-iteration loop variable", goRangeInt, "captured and assigned in loop body")
+			continue
+		}
+		copies = append(copies, &ast.AssignStmt{
+			Lhs: []ast.Expr{identAt(id.Name, body.Lbrace)},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{identAt(id.Name, body.Lbrace)},
+		})
+	}
+	body.List = append(copies, body.List...)
+}
+
+func (d *downgrader) lowerBuiltin(c *astutil.Cursor, call *ast.CallExpr) {
+	if !d.below(goBuiltins) {
+		return
+	}
+	id, ok := ast.Unparen(call.Fun).(*ast.Ident)
+	if !ok {
+		return
+	}
+	_, info, ok := d.b.infoOfNode(call)
+	if !ok {
+		return
+	}
+	bi, ok := info.Uses[id].(*types.Builtin)
+	if !ok {
+		return
+	}
+
+	var helper string
+	switch bi.Name() {
+	case "min", "max":
+		if tv := info.Types[call]; tv.Value != nil {
+			expr, err := d.b.constExpr(tv.Type, tv.Value)
+			if err != nil {
+				d.issue(call, bi.Name(), goBuiltins, err.Error())
+				return
+			}
+			c.Replace(expr)
+			return
+		}
+		helper = "bundlerMin"
+		if bi.Name() == "max" {
+			helper = "bundlerMax"
+		}
+	case "clear":
+		switch coreType(info.TypeOf(call.Args[0])).(type) {
+		case *types.Map:
+			helper = "bundlerClearMap"
+		case *types.Slice:
+			helper = "bundlerClearSlice"
+		default:
+			d.issue(call, "clear", goBuiltins, "unknown core type")
+			return
+		}
+	default:
+		return
+	}
+
+	if d.below(goGenerics) {
+		d.issue(call, bi.Name(), goBuiltins, "helpers need generics")
+		return
+	}
+	d.helpers[helper] = true
+	c.Replace(&ast.CallExpr{
+		Fun:      identAt(helper, call.Pos()),
+		Lparen:   call.Lparen,
+		Args:     call.Args,
+		Ellipsis: call.Ellipsis,
+		Rparen:   call.Rparen,
+	})
+}
+
+// downgradeHelpers replace builtins missing in older Go versions. As with the
+// builtins, a NaN argument makes the result of min and max NaN: v != v holds
+// for NaN only.
+const downgradeHelpers = `package helpers
+
+type bundlerOrdered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64 | ~string
+}
+
+func bundlerMin[T bundlerOrdered](x T, y ...T) T {
+	for _, v := range y {
+		if v != v || v < x {
+			x = v
+		}
+	}
+	return x
+}
+
+func bundlerMax[T bundlerOrdered](x T, y ...T) T {
+	for _, v := range y {
+		if v != v || v > x {
+			x = v
+		}
+	}
+	return x
+}
+
+func bundlerClearMap[M ~map[K]V, K comparable, V any](m M) {
+	for k := range m {
+		delete(m, k)
+	}
+}
+
+func bundlerClearSlice[S ~[]E, E any](s S) {
+	var zero E
+	for i := range s {
+		s[i] = zero
+	}
+}
+`
+
+func (d *downgrader) addHelpers(file *ast.File) error {
+	if len(d.helpers) == 0 {
+		return nil
+	}
+	if d.helpers["bundlerMin"] || d.helpers["bundlerMax"] {
+		d.helpers["bundlerOrdered"] = true
+	}
+	for name := range d.helpers {
+		if d.names[name] {
+			return fmt.Errorf("helper %s collides with an identifier of the bundle", name)
+		}
+	}
+
+	f, err := parser.ParseFile(d.b.mainPkg.Fset, "bundler_helpers.go", downgradeHelpers, 0)
+	if err != nil {
+		return err
+	}
+	for _, decl := range f.Decls {
+		var name string
+		switch v := decl.(type) {
+		case *ast.FuncDecl:
+			name = v.Name.Name
+		case *ast.GenDecl:
+			name = v.Specs[0].(*ast.TypeSpec).Name.Name
+		}
+		if d.helpers[name] {
+			file.Decls = append(file.Decls, decl)
+		}
+	}
+	return nil
+}
+
+// constExpr returns an expression of the constant v of type t.
+func (b *Bundler) constExpr(t types.Type, v constant.Value) (ast.Expr, error) {
+	var lit ast.Expr
+	switch v.Kind() {
+	case constant.Bool:
+		lit = ast.NewIdent(v.String())
+	case constant.String:
+		lit = &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(constant.StringVal(v))}
+	case constant.Int:
+		lit = &ast.BasicLit{Kind: token.INT, Value: v.ExactString()}
+	case constant.Float:
+		f, _ := constant.Float64Val(v)
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			// keep it an untyped float
+			s += ".0"
+		}
+		lit = &ast.BasicLit{Kind: token.FLOAT, Value: s}
+	default:
+		return nil, fmt.Errorf("unsupported constant %s", v)
+	}
+
+	if isUntyped(t) || types.Identical(t, defaultType(v.Kind())) {
+		return lit, nil
+	}
+	typ, err := b.typeExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.CallExpr{Fun: typ, Args: []ast.Expr{lit}}, nil
+}
+
+// coreType returns the underlying type of t, or for a type parameter the
+// underlying type shared by all types in its type set, if any.
+func coreType(t types.Type) types.Type {
+	tp, ok := t.(*types.TypeParam)
+	if !ok {
+		return t.Underlying()
+	}
+	iface, ok := tp.Constraint().Underlying().(*types.Interface)
+	if !ok {
+		return nil
+	}
+	var core types.Type
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		var terms []types.Type
+		switch e := iface.EmbeddedType(i).(type) {
+		case *types.Union:
+			for j := 0; j < e.Len(); j++ {
+				terms = append(terms, e.Term(j).Type().Underlying())
+			}
+		default:
+			terms = append(terms, e.Underlying())
+		}
+		for _, u := range terms {
+			if _, isIface := u.(*types.Interface); isIface {
+				continue
+			}
+			if core != nil && !types.Identical(core, u) {
+				return nil
+			}
+			core = u
+		}
+	}
+	return core
+}
+
+// defaultType returns the type an untyped constant of kind k defaults to.
+func defaultType(k constant.Kind) types.Type {
+	switch k {
+	case constant.Bool:
+		return types.Typ[types.Bool]
+	case constant.String:
+		return types.Typ[types.String]
+	case constant.Int:
+		return types.Typ[types.Int]
+	case constant.Float:
+		return types.Typ[types.Float64]
+	}
+	return nil
+}
+
+func identAt(name string, pos token.Pos) *ast.Ident {
+	return &ast.Ident{NamePos: pos, Name: name}
+}
+
+func isUntyped(t types.Type) bool {
+	b, ok := t.(*types.Basic)
+	return ok && b.Info()&types.IsUntyped != 0
+}
+
+func isBlank(e ast.Expr) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == "_"
+}
+
+// isCaptured reports whether obj is referenced by a closure in body or its
+// address is taken, explicitly or by calling a pointer method.
+func isCaptured(info *types.Info, body ast.Node, obj types.Object) bool {
+	captured := false
+	var visit func(n ast.Node, inClosure bool)
+	visit = func(root ast.Node, inClosure bool) {
+		ast.Inspect(root, func(n ast.Node) bool {
+			if captured {
+				return false
+			}
+			switch v := n.(type) {
+			case *ast.FuncLit:
+				if !inClosure {
+					visit(v.Body, true)
+					return false
+				}
+			case *ast.Ident:
+				if inClosure && info.Uses[v] == obj {
+					captured = true
+				}
+			case *ast.UnaryExpr:
+				if v.Op == token.AND && rootIdentIs(info, v.X, obj) {
+					captured = true
+				}
+			case *ast.SliceExpr:
+				if _, isArray := obj.Type().Underlying().(*types.Array); isArray && rootIdentIs(info, v.X, obj) {
+					captured = true
+				}
+			case *ast.SelectorExpr:
+				if sel := info.Selections[v]; sel != nil && sel.Kind() != types.FieldVal && rootIdentIs(info, v.X, obj) {
+					if sig, ok := sel.Obj().Type().(*types.Signature); ok && sig.Recv() != nil {
+						if _, ptrRecv := sig.Recv().Type().(*types.Pointer); ptrRecv {
+							if _, ptrVar := obj.Type().(*types.Pointer); !ptrVar {
+								captured = true
+							}
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+	visit(body, false)
+	return captured
+}
+
+// rootIdentIs reports whether e is obj or a field or array element of obj.
+func rootIdentIs(info *types.Info, e ast.Expr, obj types.Object) bool {
+	for {
+		switch v := ast.Unparen(e).(type) {
+		case *ast.Ident:
+			return info.Uses[v] == obj
+		case *ast.SelectorExpr:
+			if sel := info.Selections[v]; sel == nil || sel.Indirect() {
+				return false
+			}
+			e = v.X
+		case *ast.IndexExpr:
+			if _, isArray := info.TypeOf(v.X).Underlying().(*types.Array); !isArray {
+				return false
+			}
+			e = v.X
+		default:
+			return false
+		}
+	}
+}
+
+// isAssigned reports whether obj is assigned in body.
+func isAssigned(info *types.Info, body ast.Node, obj types.Object) bool {
+	assigned := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch v := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range v.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok && info.Uses[id] == obj {
+					assigned = true
+				}
+			}
+		case *ast.IncDecStmt:
+			if id, ok := v.X.(*ast.Ident); ok && info.Uses[id] == obj {
+				assigned = true
+			}
+		}
+		return !assigned
+	})
+	return assigned
+}
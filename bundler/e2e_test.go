@@ -0,0 +1,163 @@
+package bundler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestBundlerBehavior builds every testdata case from its original packages
+// and from the bundled source, as is, lowered to go1.20 with the std packages
+// it lacks inlined, minified and fully compacted, runs them with the same
+// inputs and compares their stdout and exit code.
+func TestBundlerBehavior(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping end-to-end test in short mode")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	cases, err := os.ReadDir("testdata/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		if !c.IsDir() {
+			continue
+		}
+		t.Run(c.Name(), func(t *testing.T) {
+			t.Parallel()
+			dir := filepath.Join("testdata/src", c.Name())
+			tmp := t.TempDir()
+
+			// original
+			orig := filepath.Join(tmp, "orig")
+			buildProgram(t, goCmd, ".", orig, "./"+filepath.ToSlash(dir))
+			type output struct {
+				stdout []byte
+				code   int
+			}
+			inputs := inputFiles(t, dir)
+			want := make([]output, len(inputs))
+			for i, input := range inputs {
+				want[i].stdout, want[i].code = runProgram(t, orig, input)
+			}
+
+			// bundled as is, for an older Go version with //line directives,
+			// minified with std packages inlined and comments kept, and
+			// compacted as much as possible
+			for _, variant := range []string{"", "1.20", "minify", "compact"} {
+				opts := Options{Dir: dir}
+				switch variant {
+				case "1.20":
+					opts.TargetGo = variant
+					opts.Annotate = AnnotateLine
+					opts.InlineStd = []string{"slices", "maps", "cmp", "iter"}
+				case "minify":
+					opts.Minify = true
+					opts.Comments = true
+					opts.InlineStd = []string{"slices", "maps", "cmp", "iter"}
+				case "compact":
+					opts.MaxSize = compactedSize(t, dir)
+				}
+				r, err := Bundle(context.Background(), opts)
+				if err != nil {
+					t.Fatalf("Bundle() error = %v", err)
+				}
+				work := filepath.Join(tmp, "variant"+variant)
+				if err := os.Mkdir(work, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if opts.TargetGo != "" {
+					// the language version of the module selects the loop semantics
+					gomod := "module bundled\n\ngo " + opts.TargetGo + "\n"
+					if err := os.WriteFile(filepath.Join(work, "go.mod"), []byte(gomod), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				src := filepath.Join(work, "main.go")
+				if err := os.WriteFile(src, r.Source, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				bundled := filepath.Join(work, "bundled")
+				buildProgram(t, goCmd, work, bundled, src)
+
+				for i, input := range inputs {
+					gotOut, gotCode := runProgram(t, bundled, input)
+					if gotCode != want[i].code {
+						t.Errorf("variant %q, input %q: exit code = %d, want %d", variant, input, gotCode, want[i].code)
+					}
+					if !bytes.Equal(gotOut, want[i].stdout) {
+						t.Errorf("variant %q, input %q: stdout =\n%s\nwant\n%s", variant, input, gotOut, want[i].stdout)
+					}
+				}
+			}
+		})
+	}
+}
+
+// compactedSize returns the size of the bundle of dir with every compaction
+// applied.
+func compactedSize(t *testing.T, dir string) int {
+	t.Helper()
+	_, err := Bundle(context.Background(), Options{Dir: dir, MaxSize: 1})
+	var sizeErr *SizeError
+	if !errors.As(err, &sizeErr) {
+		t.Fatalf("Bundle() error = %v, want *SizeError", err)
+	}
+	return sizeErr.Stats.Total.Bytes
+}
+
+func buildProgram(t *testing.T, goCmd, dir, out, target string) {
+	t.Helper()
+	cmd := exec.Command(goCmd, "build", "-o", out, target)
+	cmd.Dir = dir
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build %s: %v\n%s", target, err, msg)
+	}
+}
+
+// inputFiles returns input.txt and *.in files of a testdata case. An empty
+// name stands for empty stdin when there are none.
+func inputFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	inputs, err := filepath.Glob(filepath.Join(dir, "*.in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "input.txt")); err == nil {
+		inputs = append(inputs, filepath.Join(dir, "input.txt"))
+	}
+	if len(inputs) == 0 {
+		return []string{""}
+	}
+	return inputs
+}
+
+func runProgram(t *testing.T, bin, input string) ([]byte, int) {
+	t.Helper()
+	cmd := exec.Command(bin)
+	if input != "" {
+		f, err := os.Open(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		cmd.Stdin = f
+	}
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return out, exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("run %s: %v", bin, err)
+	}
+	return out, 0
+}
@@ -0,0 +1,600 @@
+package bundler
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// embedDirective embeds files into the package-level var declared below it.
+const embedDirective = "//go:embed"
+
+// embedFSName is the type of the bundled embed.FS vars, declared by
+// embedHelpers.
+const embedFSName = "bundlerEmbedFS"
+
+// EmbedSize is the size of the literal a //go:embed var is bundled with.
+type EmbedSize struct {
+	Package string
+	Var     string
+	Files   []string
+	Bytes   int
+}
+
+// embedVar is a //go:embed var with its inlined literal.
+type embedVar struct {
+	// end is where the type of the var ends in the original source
+	end  token.Pos
+	size EmbedSize
+	// fsType is the bundlerEmbedFS type of an embed.FS var
+	fsType *ast.Ident
+}
+
+// inlineEmbeds replaces the //go:embed vars of the bundled packages with
+// literal initializers: string and []byte vars with the content of their file,
+// embed.FS vars with a bundlerEmbedFS of their files by path. The directives
+// and the imports of embed left unused are removed, since a var with an
+// initializer cannot be embedded into.
+//
+// The literals count against Options.MaxSize like any other source, and are
+// listed by the SizeError of a bundle too large.
+func (b *Bundler) inlineEmbeds() error {
+	for _, pkg := range b.topoPkgs {
+		if isStd(pkgPath(pkg.PkgPath)) || len(pkg.EmbedFiles) == 0 {
+			continue
+		}
+		for _, f := range pkg.Syntax {
+			embeds := false
+			for _, decl := range f.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.VAR {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					vs := spec.(*ast.ValueSpec)
+					doc := vs.Doc
+					if doc == nil && !gd.Lparen.IsValid() {
+						doc = gd.Doc
+					}
+					patterns, err := embedPatterns(doc)
+					if err != nil {
+						return fmt.Errorf("%s: %w", pkg.Fset.Position(doc.Pos()), err)
+					}
+					if patterns == nil {
+						continue
+					}
+					if err := b.inlineEmbed(pkg, vs, patterns); err != nil {
+						return err
+					}
+					embeds = true
+				}
+			}
+			if embeds {
+				removeEmbedDirectives(pkg.TypesInfo, f)
+			}
+		}
+	}
+	return nil
+}
+
+// inlineEmbed sets the initializer of the //go:embed var vs to the files of
+// pkg matched by patterns.
+func (b *Bundler) inlineEmbed(pkg *packages.Package, vs *ast.ValueSpec, patterns []string) error {
+	pos := pkg.Fset.Position(vs.Pos())
+	// the literals go where the type ends, their length is recorded apart
+	end := vs.End()
+	files, err := matchEmbedFiles(filepath.Dir(pos.Filename), pkg.EmbedFiles, patterns)
+	if err != nil {
+		return fmt.Errorf("%s: %w", pos, err)
+	}
+	contents := make([]string, len(files))
+	size := 0
+	for i, name := range files {
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(pos.Filename), filepath.FromSlash(name)))
+		if err != nil {
+			return fmt.Errorf("%s: %w", pos, err)
+		}
+		contents[i] = stringLit(string(data))
+		size += len(contents[i])
+	}
+	obj := pkg.TypesInfo.Defs[vs.Names[0]]
+	if obj == nil {
+		return fmt.Errorf("%s: %s is not type-checked", pos, vs.Names[0].Name)
+	}
+	var fsType *ast.Ident
+	switch t := obj.Type().Underlying().(type) {
+	case *types.Basic:
+		// string
+		if len(files) != 1 {
+			return fmt.Errorf("%s: %s embeds %d files into a string", pos, obj.Name(), len(files))
+		}
+		vs.Values = []ast.Expr{&ast.BasicLit{ValuePos: end, Kind: token.STRING, Value: contents[0]}}
+	case *types.Slice:
+		// []byte
+		if len(files) != 1 {
+			return fmt.Errorf("%s: %s embeds %d files into a []byte", pos, obj.Name(), len(files))
+		}
+		vs.Values = []ast.Expr{&ast.CallExpr{
+			Fun:    &ast.ArrayType{Lbrack: end, Elt: ast.NewIdent("byte")},
+			Lparen: end,
+			Args:   []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: contents[0]}},
+			Rparen: end,
+		}}
+	case *types.Struct:
+		// embed.FS
+		fsType = ast.NewIdent(embedFSName)
+		lit := &ast.CompositeLit{Type: fsType, Lbrace: end, Rbrace: end}
+		for i, name := range files {
+			lit.Elts = append(lit.Elts, &ast.KeyValueExpr{
+				Key:   &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(name)},
+				Value: &ast.BasicLit{Kind: token.STRING, Value: contents[i]},
+			})
+		}
+		vs.Type = nil
+		vs.Values = []ast.Expr{lit}
+	default:
+		return fmt.Errorf("%s: cannot embed into %s of type %s", pos, obj.Name(), t)
+	}
+	if b.embeds == nil {
+		b.embeds = make(map[*ast.ValueSpec]embedVar)
+	}
+	b.embeds[vs] = embedVar{
+		end:    end,
+		size:   EmbedSize{Package: pkg.PkgPath, Var: obj.Name(), Files: files, Bytes: size},
+		fsType: fsType,
+	}
+	return nil
+}
+
+// embedPatterns returns the patterns of the //go:embed directives of doc, or
+// nil if there are none.
+func embedPatterns(doc *ast.CommentGroup) ([]string, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	var patterns []string
+	for _, c := range doc.List {
+		args, ok := strings.CutPrefix(c.Text, embedDirective+" ")
+		if !ok {
+			continue
+		}
+		list, err := embedArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, list...)
+	}
+	return patterns, nil
+}
+
+// embedArgs splits the arguments of a //go:embed directive as cmd/go does:
+// at spaces, but for those of arguments quoted with double or back quotes.
+func embedArgs(args string) ([]string, error) {
+	var list []string
+	for {
+		args = strings.TrimLeftFunc(args, unicode.IsSpace)
+		if args == "" {
+			return list, nil
+		}
+		var arg string
+		switch args[0] {
+		case '"', '`':
+			quoted, err := strconv.QuotedPrefix(args)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted string in %s: %s", embedDirective, args)
+			}
+			arg, _ = strconv.Unquote(quoted)
+			args = args[len(quoted):]
+			if r, _ := utf8.DecodeRuneInString(args); args != "" && !unicode.IsSpace(r) {
+				return nil, fmt.Errorf("invalid quoted string in %s: %s", embedDirective, quoted+args)
+			}
+		default:
+			i := strings.IndexFunc(args, unicode.IsSpace)
+			if i < 0 {
+				i = len(args)
+			}
+			arg, args = args[:i], args[i:]
+		}
+		list = append(list, arg)
+	}
+}
+
+// matchEmbedFiles returns the slash-separated paths, relative to dir, of the
+// files matched by patterns among embedFiles, the files embedded by any var
+// of the package. As with go:embed, a pattern naming a directory matches the
+// files in it but those whose name begins with . or _, unless prefixed with
+// all:.
+func matchEmbedFiles(dir string, embedFiles, patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		pattern, all := strings.CutPrefix(pattern, "all:")
+		matched := false
+		for _, file := range embedFiles {
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return nil, err
+			}
+			rel = filepath.ToSlash(rel)
+			if matchEmbedFile(pattern, rel, all) {
+				matched = true
+				if !slices.Contains(files, rel) {
+					files = append(files, rel)
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("pattern %s: no matching files found", pattern)
+		}
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// matchEmbedFile reports whether pattern matches the file rel or a
+// directory containing it.
+func matchEmbedFile(pattern, rel string, all bool) bool {
+	if ok, _ := path.Match(pattern, rel); ok {
+		return true
+	}
+	elems := strings.Split(rel, "/")
+	for i := 1; i < len(elems); i++ {
+		if ok, _ := path.Match(pattern, strings.Join(elems[:i], "/")); !ok {
+			continue
+		}
+		if all {
+			return true
+		}
+		return !slices.ContainsFunc(elems[i:], func(e string) bool {
+			return strings.HasPrefix(e, ".") || strings.HasPrefix(e, "_")
+		})
+	}
+	return false
+}
+
+// bundledEmbeds returns the //go:embed vars of the bundled file.
+func (b *Bundler) bundledEmbeds() []embedVar {
+	var vars []embedVar
+	for _, decl := range b.bundled.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok {
+			for _, spec := range gd.Specs {
+				if vs, ok := spec.(*ast.ValueSpec); ok {
+					if v, ok := b.embeds[vs]; ok {
+						vars = append(vars, v)
+					}
+				}
+			}
+		}
+	}
+	return vars
+}
+
+// embedSizes returns the sizes of the bundled //go:embed vars.
+func (b *Bundler) embedSizes() []EmbedSize {
+	var sizes []EmbedSize
+	for _, v := range b.bundledEmbeds() {
+		sizes = append(sizes, v.size)
+	}
+	return sizes
+}
+
+// checkEmbedFS returns an UnsupportedError listing the uses of the embed.FS
+// type in the bundled declarations of file if an embed.FS var is bundled.
+// Its value is of type bundlerEmbedFS now, which cannot be passed as an
+// embed.FS, stored in one or converted to one.
+func (b *Bundler) checkEmbedFS(file *ast.File) error {
+	if !slices.ContainsFunc(b.bundledEmbeds(), func(v embedVar) bool { return v.fsType != nil }) {
+		return nil
+	}
+	var issues []UnsupportedIssue
+	ast.Inspect(file, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		pkg, info, ok := b.infoOfNode(id)
+		if !ok {
+			return true
+		}
+		if tn, ok := info.Uses[id].(*types.TypeName); ok && tn.Pkg() != nil && tn.Pkg().Path() == "embed" && tn.Name() == "FS" {
+			issues = append(issues, UnsupportedIssue{
+				Pos:       pkg.Fset.Position(id.Pos()),
+				Package:   pkg.PkgPath,
+				Construct: "embed.FS type (inlined //go:embed vars are " + embedFSName + ")",
+			})
+		}
+		return true
+	})
+	if len(issues) > 0 {
+		return &UnsupportedError{Issues: issues}
+	}
+	return nil
+}
+
+// stringLit returns a literal of s, raw unless s holds characters a raw
+// string literal cannot.
+func stringLit(s string) string {
+	if utf8.ValidString(s) && !strings.ContainsAny(s, "`\r\x00\ufeff") {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+// removeEmbedDirectives removes the //go:embed directives of f, and its
+// import of embed once unused.
+func removeEmbedDirectives(info *types.Info, f *ast.File) {
+	comments := f.Comments[:0]
+	for _, g := range f.Comments {
+		list := g.List[:0]
+		var directive *ast.Comment
+		for _, c := range g.List {
+			if strings.HasPrefix(c.Text, embedDirective+" ") {
+				directive = c
+			} else {
+				list = append(list, c)
+			}
+		}
+		// the blank line separating the directive from the doc goes too
+		for directive != nil && len(list) > 0 && list[len(list)-1].Text == "//" {
+			list = list[:len(list)-1]
+		}
+		if directive != nil && len(list) > 0 {
+			// the last line of the doc takes the place of the directive, or
+			// the printer would leave a blank line there
+			list[len(list)-1].Slash = directive.Slash
+		}
+		g.List = list
+		if len(list) > 0 {
+			comments = append(comments, g)
+		}
+	}
+	f.Comments = comments
+
+	// the types of the inlined embed.FS vars are gone
+	usesEmbed := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if pn, ok := info.Uses[id].(*types.PkgName); ok && pn.Imported().Path() == "embed" {
+				usesEmbed = true
+			}
+		}
+		return !usesEmbed
+	})
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Doc != nil && len(d.Doc.List) == 0 {
+				d.Doc = nil
+			}
+			for _, spec := range d.Specs {
+				if vs, ok := spec.(*ast.ValueSpec); ok && vs.Doc != nil && len(vs.Doc.List) == 0 {
+					vs.Doc = nil
+				}
+			}
+			if d.Tok == token.IMPORT && !usesEmbed {
+				d.Specs = slices.DeleteFunc(d.Specs, func(spec ast.Spec) bool {
+					return spec.(*ast.ImportSpec).Path.Value == `"embed"`
+				})
+			}
+		case *ast.FuncDecl:
+			if d.Doc != nil && len(d.Doc.List) == 0 {
+				d.Doc = nil
+			}
+		}
+	}
+}
+
+// embedHelpers implement embed.FS over the contents of the embedded files by
+// path. Directories are implied by the paths of the files in them.
+const embedHelpers = `package helpers
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+type bundlerEmbedFS map[string]string
+
+func (f bundlerEmbedFS) Open(name string) (fs.File, error) {
+	file, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (f bundlerEmbedFS) ReadFile(name string) ([]byte, error) {
+	file, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if file.dir {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	return []byte(file.data), nil
+}
+
+func (f bundlerEmbedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !file.dir {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("not a directory")}
+	}
+	return file.entries, nil
+}
+
+func (f bundlerEmbedFS) lookup(op, name string) (*bundlerEmbedFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	base := name[strings.LastIndex(name, "/")+1:]
+	if data, ok := f[name]; ok {
+		return &bundlerEmbedFile{name: base, data: data}, nil
+	}
+	dir := &bundlerEmbedFile{name: base, dir: true}
+	seen := make(map[string]bool)
+	for p, data := range f {
+		rest := p
+		if name != "." {
+			if !strings.HasPrefix(p, name+"/") {
+				continue
+			}
+			rest = p[len(name)+1:]
+		}
+		elem, _, sub := strings.Cut(rest, "/")
+		if seen[elem] {
+			continue
+		}
+		seen[elem] = true
+		child := &bundlerEmbedFile{name: elem, dir: sub}
+		if !sub {
+			child.data = data
+		}
+		dir.entries = append(dir.entries, child)
+	}
+	if name != "." && len(dir.entries) == 0 {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(dir.entries, func(i, j int) bool {
+		return dir.entries[i].Name() < dir.entries[j].Name()
+	})
+	return dir, nil
+}
+
+type bundlerEmbedFile struct {
+	name    string
+	data    string
+	dir     bool
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (f *bundlerEmbedFile) Name() string               { return f.name }
+func (f *bundlerEmbedFile) Size() int64                { return int64(len(f.data)) }
+func (f *bundlerEmbedFile) ModTime() time.Time         { return time.Time{} }
+func (f *bundlerEmbedFile) IsDir() bool                { return f.dir }
+func (f *bundlerEmbedFile) Sys() any                   { return nil }
+func (f *bundlerEmbedFile) Type() fs.FileMode          { return f.Mode().Type() }
+func (f *bundlerEmbedFile) Info() (fs.FileInfo, error) { return f, nil }
+func (f *bundlerEmbedFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f *bundlerEmbedFile) Close() error               { return nil }
+
+func (f *bundlerEmbedFile) Mode() fs.FileMode {
+	if f.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+func (f *bundlerEmbedFile) Read(p []byte) (int, error) {
+	if f.dir {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	if f.offset >= len(f.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[f.offset:])
+	f.offset += n
+	return n, nil
+}
+
+func (f *bundlerEmbedFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := f.entries[f.offset:]
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	f.offset += len(entries)
+	return entries, nil
+}
+`
+
+// addEmbedHelpers appends the declarations of embedHelpers to file if an
+// embed.FS var is bundled.
+func (b *Bundler) addEmbedHelpers(file *ast.File) error {
+	fsTypes := make(map[*ast.Ident]bool)
+	for _, v := range b.bundledEmbeds() {
+		if v.fsType != nil {
+			fsTypes[v.fsType] = true
+		}
+	}
+	if len(fsTypes) == 0 {
+		// no embed.FS var is bundled
+		return nil
+	}
+	names := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && !fsTypes[id] {
+			names[id.Name] = true
+		}
+		return true
+	})
+	for _, name := range []string{embedFSName, "bundlerEmbedFile"} {
+		if names[name] {
+			return fmt.Errorf("helper %s collides with an identifier of the bundle", name)
+		}
+	}
+
+	f, err := parser.ParseFile(b.mainPkg.Fset, "bundler_embed.go", embedHelpers, 0)
+	if err != nil {
+		return err
+	}
+	// the imports of the helpers join those of the bundle, which goimports
+	// would add as a group of their own
+	var importDecl *ast.GenDecl
+	if len(file.Decls) > 0 {
+		if gd, ok := file.Decls[0].(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			importDecl = gd
+		}
+	}
+	if importDecl == nil {
+		importDecl = &ast.GenDecl{Tok: token.IMPORT}
+		file.Decls = slices.Insert(file.Decls, 0, ast.Decl(importDecl))
+	}
+	for _, spec := range f.Imports {
+		if !slices.ContainsFunc(importDecl.Specs, func(s ast.Spec) bool {
+			return s.(*ast.ImportSpec).Path.Value == spec.Path.Value
+		}) {
+			importDecl.Specs = append(importDecl.Specs, spec)
+		}
+	}
+	slices.SortFunc(importDecl.Specs, func(x, y ast.Spec) int {
+		return strings.Compare(x.(*ast.ImportSpec).Path.Value, y.(*ast.ImportSpec).Path.Value)
+	})
+	// the specs come from several files, their lines would split the group
+	for i, spec := range importDecl.Specs {
+		is := spec.(*ast.ImportSpec)
+		imp := &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: is.Path.Value}}
+		if is.Name != nil {
+			imp.Name = ast.NewIdent(is.Name.Name)
+		}
+		importDecl.Specs[i] = imp
+	}
+
+	for _, decl := range f.Decls {
+		if gd, ok := decl.(*ast.GenDecl); !ok || gd.Tok != token.IMPORT {
+			file.Decls = append(file.Decls, decl)
+		}
+	}
+	return nil
+}
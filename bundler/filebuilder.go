@@ -1,19 +1,16 @@
-package main
+package bundler
 
 import (
 	"errors"
-	"fmt"
 	"go/ast"
 	"go/token"
-	"path/filepath"
 	"sort"
 	"strings"
 )
 
 type FileBuilder struct {
 	// input
-	fset       *token.FileSet
-	filePkgMap map[string]pkgPath
+	external func(pkgPath) bool
 
 	// cache
 	stdImports map[pkgPath]*ast.ImportSpec
@@ -21,44 +18,30 @@ type FileBuilder struct {
 	valueSpecs []*ast.ValueSpec
 	constDecls []*ast.GenDecl // constはiotaとかあるのでdecl単位
 	initDecls  []*ast.FuncDecl
+	initStmts  []ast.Stmt
 	mainDecl   *ast.FuncDecl
 	funcDecls  []*ast.FuncDecl
+
+	// output
+	declPos map[ast.Decl]token.Pos
 }
 
-func NewBuilder(fset *token.FileSet, paths map[string]pkgPath) *FileBuilder {
+func NewBuilder(external func(pkgPath) bool) *FileBuilder {
 	return &FileBuilder{
-		fset:       fset,
-		filePkgMap: paths,
+		external:   external,
 		stdImports: make(map[pkgPath]*ast.ImportSpec, 128),
 		typeSpecs:  make([]*ast.TypeSpec, 0),
 		valueSpecs: make([]*ast.ValueSpec, 0),
 		constDecls: make([]*ast.GenDecl, 0),
 		initDecls:  make([]*ast.FuncDecl, 0),
 		funcDecls:  make([]*ast.FuncDecl, 0),
-	}
-}
-
-func (b *FileBuilder) commentGroup(t token.Pos) *ast.CommentGroup {
-	pos := b.fset.Position(t)
-	fp := filepath.ToSlash(pos.Filename)
-	name := filepath.Base(fp)
-	var pp pkgPath
-	var ok bool
-	pp, ok = b.filePkgMap[fp]
-	if !ok {
-		pp = "unknown"
-	}
-
-	return &ast.CommentGroup{
-		List: []*ast.Comment{
-			{Text: fmt.Sprintf("// %s/%s:%d:%d", pp, name, pos.Line, pos.Column)},
-		},
+		declPos:    make(map[ast.Decl]token.Pos, 128),
 	}
 }
 
 func (b *FileBuilder) addImportSpec(n *ast.ImportSpec) {
 	path := pkgPath(strings.Trim(n.Path.Value, `"`))
-	if isStd(path) {
+	if b.external(path) {
 		b.stdImports[path] = n
 	}
 }
@@ -77,8 +60,21 @@ func (b *FileBuilder) addConstDecl(n *ast.GenDecl) {
 	}
 }
 
-func (b *FileBuilder) addInitDecl(n *ast.FuncDecl) {
+// addInitDecl adds a renamed init function. call is the name it is called
+// by from the synthetic init.
+func (b *FileBuilder) addInitDecl(n *ast.FuncDecl, call string) {
 	b.initDecls = append(b.initDecls, n)
+	b.initStmts = append(b.initStmts, &ast.ExprStmt{
+		X: &ast.CallExpr{
+			Fun: ast.NewIdent(call),
+		},
+	})
+}
+
+// addInitStmt appends stmt to the synthetic init. Statements run in the order
+// of addition.
+func (b *FileBuilder) addInitStmt(stmt ast.Stmt) {
+	b.initStmts = append(b.initStmts, stmt)
 }
 
 func (b *FileBuilder) setMainDecl(n *ast.FuncDecl) {
@@ -118,68 +114,67 @@ func (b *FileBuilder) Build() (*ast.File, error) {
 	}
 
 	// add inits
-	if len(b.initDecls) > 0 {
+	if len(b.initStmts) > 0 {
 		initDecl := &ast.FuncDecl{
 			Name: ast.NewIdent("init"),
 			Type: &ast.FuncType{
 				Params: &ast.FieldList{},
 			},
 			Body: &ast.BlockStmt{
-				List: []ast.Stmt{},
+				List: b.initStmts,
 			},
 		}
 		file.Decls = append(file.Decls, initDecl)
 		for _, d := range b.initDecls {
-			stmt := &ast.ExprStmt{
-				X: &ast.CallExpr{
-					Fun: d.Name,
-				},
-			}
-			initDecl.Body.List = append(initDecl.Body.List, stmt)
-			file.Decls = append(file.Decls, d)
+			b.appendDecl(file, d, d.Pos())
 		}
 	}
 
 	// add types
 	for _, v := range b.typeSpecs {
 		decl := &ast.GenDecl{
+			Doc:   v.Doc,
 			Tok:   token.TYPE,
 			Specs: []ast.Spec{v},
-			Doc:   b.commentGroup(v.Pos()),
 		}
-		file.Decls = append(file.Decls, decl)
+		b.appendDecl(file, decl, v.Pos())
 	}
 
 	// add values
 	for _, v := range b.valueSpecs {
 		decl := &ast.GenDecl{
+			Doc:   v.Doc,
 			Tok:   token.VAR,
 			Specs: []ast.Spec{v},
-			Doc:   b.commentGroup(v.Pos()),
 		}
-		file.Decls = append(file.Decls, decl)
+		b.appendDecl(file, decl, v.Pos())
 	}
 
 	// add consts
 	for _, d := range b.constDecls {
-		d.Doc = b.commentGroup(d.Pos())
-		file.Decls = append(file.Decls, d)
+		b.appendDecl(file, d, d.Pos())
 	}
 
 	// add funcs
 	mainDecl := &ast.FuncDecl{
-		Name: ast.NewIdent("main"),
+		Name: &ast.Ident{NamePos: b.mainDecl.Name.Pos(), Name: "main"},
 		Type: &ast.FuncType{
+			Func:   b.mainDecl.Type.Func,
 			Params: &ast.FieldList{},
 		},
 		Body: b.mainDecl.Body,
-		Doc:  b.commentGroup(b.mainDecl.Pos()),
+		Doc:  b.mainDecl.Doc,
 	}
-	file.Decls = append(file.Decls, mainDecl)
+	b.appendDecl(file, mainDecl, b.mainDecl.Pos())
 	for _, d := range b.funcDecls {
-		d.Doc = b.commentGroup(d.Pos())
-		file.Decls = append(file.Decls, d)
+		b.appendDecl(file, d, d.Pos())
 	}
 
 	return file, nil
 }
+
+// appendDecl appends decl to file and records pos as its original position.
+func (b *FileBuilder) appendDecl(file *ast.File, decl ast.Decl, pos token.Pos) {
+	file.Decls = append(file.Decls, decl)
+	b.declPos[decl] = pos
+}
@@ -0,0 +1,199 @@
+package bundler
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Graph is the import graph of the bundled packages and the graph of their
+// package-level declarations.
+type Graph struct {
+	// Package is the import path of the main package.
+	Package string `json:"package"`
+
+	// Packages are the bundled packages in the order of Result.Packages.
+	Packages []GraphPackage `json:"packages"`
+
+	// Decls are the declarations of Packages in package and source order,
+	// followed by the initializer of each package.
+	Decls []GraphDecl `json:"decls"`
+}
+
+// GraphPackage is a node of the import graph.
+type GraphPackage struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+
+	// Imports are the bundled packages imported by the package.
+	Imports []string `json:"imports,omitempty"`
+}
+
+// GraphDecl is a node of the declaration graph.
+type GraphDecl struct {
+	// ID is Decl qualified by the import path instead of the package name.
+	ID      string `json:"id"`
+	Decl    string `json:"decl"`
+	Package string `json:"package"`
+
+	// Kind is one of "func", "method", "type", "var", "const" and "init",
+	// the initializer of the package.
+	Kind string `json:"kind"`
+
+	// Reachable reports whether the declaration is bundled, and Reason why.
+	Reachable bool   `json:"reachable"`
+	Reason    Reason `json:"reason,omitempty"`
+
+	Edges []GraphEdge `json:"edges,omitempty"`
+}
+
+// GraphEdge makes the declaration To reachable if its source is.
+type GraphEdge struct {
+	To     string `json:"to"`
+	Reason Reason `json:"reason"`
+}
+
+// graph builds the graphs of the bundle. Edges to declarations outside the
+// bundled packages, such as std functions calling back into them, are
+// omitted.
+func (b *Bundler) graph() Graph {
+	names := b.initFuncDeclNames()
+	a := b.analysis
+	g := Graph{Package: b.mainPkg.PkgPath}
+
+	for _, pkg := range b.topoPkgs {
+		gp := GraphPackage{Path: pkg.PkgPath, Name: pkg.Name}
+		for path := range pkg.Imports {
+			if !b.isExternal(pkgPath(path)) {
+				gp.Imports = append(gp.Imports, path)
+			}
+		}
+		slices.Sort(gp.Imports)
+		g.Packages = append(g.Packages, gp)
+	}
+
+	// nodes
+	var objs []types.Object
+	for _, pkg := range b.topoPkgs {
+		objs = append(objs, pkgDecls(pkg)...)
+	}
+	for _, pkg := range b.topoPkgs {
+		if obj, ok := a.pkgInits[pkg.Types]; ok {
+			objs = append(objs, obj)
+		}
+	}
+	index := make(map[types.Object]int, len(objs))
+	for i, obj := range objs {
+		index[obj] = i
+		decl := declString(obj, names)
+		_, rest, _ := strings.Cut(decl, ".")
+		g.Decls = append(g.Decls, GraphDecl{
+			ID:        obj.Pkg().Path() + "." + rest,
+			Decl:      decl,
+			Package:   obj.Pkg().Path(),
+			Kind:      a.declKind(obj),
+			Reachable: a.reachableDecls[obj],
+			Reason:    a.reasons[obj],
+		})
+	}
+
+	// edges, the first one to each target in target order
+	for i, obj := range objs {
+		reasons := make(map[int]Reason)
+		for _, e := range a.declGraph[obj] {
+			j, ok := index[origin(e.to)]
+			if !ok || j == i {
+				continue
+			}
+			if _, ok := reasons[j]; !ok {
+				reasons[j] = e.reason
+			}
+		}
+		targets := make([]int, 0, len(reasons))
+		for j := range reasons {
+			targets = append(targets, j)
+		}
+		slices.Sort(targets)
+		for _, j := range targets {
+			g.Decls[i].Edges = append(g.Decls[i].Edges, GraphEdge{To: g.Decls[j].ID, Reason: reasons[j]})
+		}
+	}
+	return g
+}
+
+// declKind returns the GraphDecl.Kind of obj.
+func (a *ReachabilityAnalyzer) declKind(obj types.Object) string {
+	switch o := obj.(type) {
+	case *types.Func:
+		if a.pkgInits[o.Pkg()] == obj {
+			return "init"
+		}
+		if o.Type().(*types.Signature).Recv() != nil {
+			return "method"
+		}
+		return "func"
+	case *types.TypeName:
+		return "type"
+	case *types.Var:
+		return "var"
+	case *types.Const:
+		return "const"
+	}
+	return ""
+}
+
+// WriteJSON writes g as indented JSON.
+func (g Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(g)
+}
+
+// WriteDOT writes g as two Graphviz digraphs: the import graph, and the
+// declaration graph clustered by package with unreachable declarations
+// dashed.
+func (g Graph) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "digraph %q {\n", g.Package+" packages")
+	sb.WriteString("\tnode [shape=box];\n")
+	for _, p := range g.Packages {
+		fmt.Fprintf(&sb, "\t%q [label=%q];\n", p.Path, p.Name+"\n"+p.Path)
+	}
+	for _, p := range g.Packages {
+		for _, imp := range p.Imports {
+			fmt.Fprintf(&sb, "\t%q -> %q;\n", p.Path, imp)
+		}
+	}
+	sb.WriteString("}\n")
+
+	fmt.Fprintf(&sb, "digraph %q {\n", g.Package+" decls")
+	sb.WriteString("\trankdir=LR;\n\tnode [shape=box];\n")
+	for i, p := range g.Packages {
+		fmt.Fprintf(&sb, "\tsubgraph \"cluster_%d\" {\n", i)
+		fmt.Fprintf(&sb, "\t\tlabel=%q;\n", p.Path)
+		for _, d := range g.Decls {
+			if d.Package != p.Path {
+				continue
+			}
+			style := "solid"
+			if !d.Reachable {
+				style = "dashed"
+			}
+			fmt.Fprintf(&sb, "\t\t%q [label=%q, style=%s];\n", d.ID, d.Decl, style)
+		}
+		sb.WriteString("\t}\n")
+	}
+	for _, d := range g.Decls {
+		for _, e := range d.Edges {
+			fmt.Fprintf(&sb, "\t%q -> %q [label=%q];\n", d.ID, e.To, e.Reason)
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,236 @@
+package bundler
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// layoutInit adds package-level vars and init functions to the builder so
+// that the bundled program initializes them in the same observable order as
+// the original one.
+//
+// Go initializes a dependency package's vars and runs its init functions
+// before the importer's vars are initialized, while a single bundled package
+// initializes all vars before any init function. Once a package with init
+// functions has been laid out, vars of later packages whose initializers are
+// not static are therefore declared without value and assigned in the
+// synthetic init, in between the init functions.
+func (b *Bundler) layoutInit(builder *FileBuilder, reachable map[types.Object]bool, varSpecs map[pkgPath][]*ast.ValueSpec, initDecls map[pkgPath][]*ast.FuncDecl) error {
+	chained := false
+	for _, pkg := range b.initPkgs {
+		pp := pkgPath(pkg.PkgPath)
+		info := pkg.TypesInfo
+
+		// var initializers, in the order of the package's dependency analysis
+		moved := make(map[*types.Var]bool)
+		if chained {
+			for _, in := range info.InitOrder {
+				if !keepInitializer(in, reachable) || isStaticInit(info, in.Rhs) {
+					continue
+				}
+				stmt := &ast.AssignStmt{
+					Tok: token.ASSIGN,
+					Rhs: []ast.Expr{in.Rhs},
+				}
+				for _, v := range in.Lhs {
+					moved[v] = true
+					stmt.Lhs = append(stmt.Lhs, ast.NewIdent(b.varName(pp, v)))
+				}
+				builder.addInitStmt(stmt)
+			}
+		}
+
+		for _, spec := range varSpecs[pp] {
+			if err := b.addVarSpec(builder, info, spec, reachable, moved); err != nil {
+				return err
+			}
+		}
+
+		// init functions are renamed to unique helpers and called in file
+		// order, then source order
+		decls := initDecls[pp]
+		names := initFuncNames(pkg, len(decls))
+		for i, d := range decls {
+			d.Name.Name = names[i]
+			call, _ := b.addPrefix(pp, d.Name)
+			builder.addInitDecl(d, call)
+		}
+		if len(decls) > 0 {
+			chained = true
+		}
+	}
+	return nil
+}
+
+// addVarSpec adds spec if any of its names is reachable. Names whose
+// initialization was moved into the synthetic init are declared without value.
+// Unreachable names are dropped unless they share a multi-value initializer;
+// their initializers do not call functions, or they would be reachable.
+func (b *Bundler) addVarSpec(builder *FileBuilder, info *types.Info, spec *ast.ValueSpec, reachable map[types.Object]bool, moved map[*types.Var]bool) error {
+	separable := len(spec.Values) == 0 || len(spec.Values) == len(spec.Names)
+	var used, split bool
+	for _, name := range spec.Names {
+		obj, ok := info.Defs[name].(*types.Var)
+		if !ok {
+			continue
+		}
+		if reachable[obj] {
+			used = true
+		} else if separable {
+			split = true
+		}
+		if moved[obj] {
+			split = true
+		}
+	}
+	if !used {
+		return nil
+	}
+	if !split {
+		builder.addValueSpec(spec)
+		return nil
+	}
+
+	first := true
+	for i, name := range spec.Names {
+		obj, _ := info.Defs[name].(*types.Var)
+		if name.Name == "_" && moved[obj] {
+			// assigned in the synthetic init, nothing to declare
+			continue
+		}
+		if separable && !reachable[obj] {
+			continue
+		}
+		s := &ast.ValueSpec{
+			Names: []*ast.Ident{name},
+			Type:  spec.Type,
+		}
+		if first {
+			// the comments go with the first declared name
+			s.Doc, s.Comment = spec.Doc, spec.Comment
+			first = false
+		}
+		if !moved[obj] && len(spec.Values) == len(spec.Names) {
+			s.Values = []ast.Expr{spec.Values[i]}
+		}
+		if s.Type == nil && s.Values == nil && obj != nil {
+			typ, err := b.typeExpr(obj.Type())
+			if err != nil {
+				return err
+			}
+			s.Type = typ
+		}
+		builder.addValueSpec(s)
+	}
+	return nil
+}
+
+// varName returns the bundled name of the package-level var v.
+func (b *Bundler) varName(pp pkgPath, v *types.Var) string {
+	if v.Name() == "_" {
+		return "_"
+	}
+	name, _ := b.addPrefix(pp, ast.NewIdent(v.Name()))
+	return name
+}
+
+func keepInitializer(in *types.Initializer, reachable map[types.Object]bool) bool {
+	for _, v := range in.Lhs {
+		if reachable[v] {
+			return true
+		}
+	}
+	return false
+}
+
+// isStaticInit reports whether e neither calls functions nor reads
+// package-level vars, so evaluating it earlier than in the original program
+// is not observable.
+func isStaticInit(info *types.Info, e ast.Expr) bool {
+	reads, calls := initEffects(info, e)
+	return !reads && !calls
+}
+
+// initEffects reports whether evaluating e reads package-level vars and
+// whether it calls functions other than conversions and pure builtins.
+// Bodies of function literals are not evaluated and thus ignored.
+func initEffects(info *types.Info, e ast.Expr) (reads, calls bool) {
+	ast.Inspect(e, func(n ast.Node) bool {
+		if x, ok := n.(ast.Expr); ok {
+			if tv, ok := info.Types[x]; ok && tv.Value != nil {
+				// constant
+				return false
+			}
+		}
+
+		switch v := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.UnaryExpr:
+			if v.Op == token.ARROW {
+				calls = true
+			}
+		case *ast.CallExpr:
+			if !isPureCall(info, v) {
+				calls = true
+			}
+		case *ast.Ident:
+			if obj, ok := info.Uses[v].(*types.Var); ok && isPkgLevelVar(obj) {
+				reads = true
+			}
+		}
+		return true
+	})
+	return reads, calls
+}
+
+// pureBuiltins are builtins without side effects on their operands.
+var pureBuiltins = map[string]bool{
+	"append":  true,
+	"cap":     true,
+	"complex": true,
+	"imag":    true,
+	"len":     true,
+	"make":    true,
+	"max":     true,
+	"min":     true,
+	"new":     true,
+	"real":    true,
+}
+
+func isPureCall(info *types.Info, call *ast.CallExpr) bool {
+	fun := ast.Unparen(call.Fun)
+	if tv, ok := info.Types[fun]; ok && tv.IsType() {
+		// conversion
+		return true
+	}
+	if id, ok := fun.(*ast.Ident); ok {
+		if bi, ok := info.Uses[id].(*types.Builtin); ok {
+			return pureBuiltins[bi.Name()]
+		}
+	}
+	return false
+}
+
+// initCallRoots returns package-level vars of pkgs whose initializers call
+// functions. Their side effects are observable even if they are never used.
+func initCallRoots(pkgs []*packages.Package) []types.Object {
+	roots := make([]types.Object, 0)
+	for _, p := range pkgs {
+		if p.TypesInfo == nil {
+			continue
+		}
+		for _, in := range p.TypesInfo.InitOrder {
+			if _, calls := initEffects(p.TypesInfo, in.Rhs); !calls {
+				continue
+			}
+			for _, v := range in.Lhs {
+				roots = append(roots, v)
+			}
+		}
+	}
+	return roots
+}
@@ -0,0 +1,159 @@
+package bundler
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// minify renames the package-level declarations of the library packages and
+// the locals of their code to short names. The main package and generated
+// declarations keep their names, as do methods and fields.
+//
+// New names are never used anywhere else in src, and the locals of one
+// declaration all get distinct names, so no renamed identifier can shadow or
+// be shadowed by another. The result is type-checked again.
+func (b *Bundler) minify(src []byte) ([]byte, error) {
+	fset, file, info, err := checkFile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			used[id.Name] = true
+		}
+		return true
+	})
+	// types named like an embedded field keep their names, so that the field
+	// keeps its name too
+	embedded := make(map[string]bool)
+	for _, obj := range info.Defs {
+		if v, ok := obj.(*types.Var); ok && v.Embedded() {
+			embedded[v.Name()] = true
+		}
+	}
+
+	mainPath := pkgPath(b.mainPkg.PkgPath)
+	got := nonImportDecls(file.Decls)
+	orig := nonImportDecls(b.bundled.Decls)
+	if len(got) != len(orig) {
+		return nil, fmt.Errorf("%d declarations in output, %d bundled", len(got), len(orig))
+	}
+
+	names := make(map[types.Object]string)
+	pkgScope := func(obj types.Object) bool {
+		return obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope()
+	}
+
+	// package-level declarations
+	next := 0
+	var libDecls []ast.Decl
+	for i, decl := range got {
+		if pp, ok := b.declPkg(orig[i]); !ok || pp == mainPath {
+			continue
+		}
+		libDecls = append(libDecls, decl)
+		for _, name := range declNames(decl) {
+			if embedded[name] {
+				continue
+			}
+			if obj := info.Defs[declIdent(decl, name)]; obj != nil && pkgScope(obj) {
+				names[obj] = freshName(&next, used)
+			}
+		}
+	}
+
+	// locals, numbered from where the package-level names stopped
+	for _, decl := range libDecls {
+		local := next
+		ast.Inspect(decl, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			obj := info.Defs[id]
+			if obj == nil || pkgScope(obj) || id.Name == "_" {
+				return true
+			}
+			switch o := obj.(type) {
+			case *types.Var:
+				if o.IsField() {
+					return true
+				}
+			case *types.Const, *types.TypeName:
+			default:
+				// methods of interfaces, labels
+				return true
+			}
+			names[obj] = freshName(&local, used)
+			return true
+		})
+	}
+
+	rename := func(id *ast.Ident, obj types.Object) {
+		if obj == nil {
+			return
+		}
+		if name, ok := names[origin(obj)]; ok {
+			id.Name = name
+		}
+	}
+	for id, obj := range info.Defs {
+		rename(id, obj)
+	}
+	for id, obj := range info.Uses {
+		rename(id, obj)
+	}
+
+	out, err := printFile(fset, file)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, _, err := checkFile(out); err != nil {
+		return nil, fmt.Errorf("minified source does not type-check: %w", err)
+	}
+	return out, nil
+}
+
+// freshName returns the next short name, starting from *n, that is not used
+// in the file and is neither a keyword, predeclared nor special to package
+// main.
+func freshName(n *int, used map[string]bool) string {
+	for {
+		name := shortName(*n)
+		*n++
+		switch {
+		case used[name], token.IsKeyword(name), types.Universe.Lookup(name) != nil:
+		case name == "init", name == "main":
+		default:
+			return name
+		}
+	}
+}
+
+// declIdent returns the identifier declaring name in decl.
+func declIdent(decl ast.Decl, name string) *ast.Ident {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Name
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				if s.Name.Name == name {
+					return s.Name
+				}
+			case *ast.ValueSpec:
+				for _, id := range s.Names {
+					if id.Name == name {
+						return id
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
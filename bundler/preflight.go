@@ -0,0 +1,152 @@
+package bundler
+
+import (
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// UnsupportedError is returned when a bundled package uses constructs that
+// cannot be merged into a single Go file.
+type UnsupportedError struct {
+	Issues []UnsupportedIssue
+}
+
+func (e *UnsupportedError) Error() string {
+	lines := make([]string, 0, len(e.Issues)+1)
+	lines = append(lines, "cannot bundle:")
+	for _, i := range e.Issues {
+		lines = append(lines, "\t"+i.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// UnsupportedIssue is a construct of a package that cannot be bundled.
+type UnsupportedIssue struct {
+	// Pos is the position in the original sources. Files as a whole, such
+	// as assembly files, have no line.
+	Pos       token.Position
+	Package   string
+	Construct string
+	// Fallback is the pure-Go file built with the purego tag instead, if
+	// any.
+	Fallback string
+}
+
+func (i UnsupportedIssue) String() string {
+	s := fmt.Sprintf("%s: %s in %s", i.Pos, i.Construct, i.Package)
+	if i.Fallback != "" {
+		s += fmt.Sprintf(" (build with -tags purego to use %s instead)", filepath.Base(i.Fallback))
+	}
+	return s
+}
+
+// preflight checks the bundled packages for assembly, cgo and //go:linkname,
+// which the bundle cannot carry. Inlined std packages are left
+// to the declarations reached, since few of their functions use them.
+func (b *Bundler) preflight() error {
+	var issues []UnsupportedIssue
+	for _, pkg := range b.topoPkgs {
+		if isStd(pkgPath(pkg.PkgPath)) {
+			continue
+		}
+		issues = append(issues, b.unsupported(pkg)...)
+	}
+	if len(issues) > 0 {
+		return &UnsupportedError{Issues: issues}
+	}
+	return nil
+}
+
+// unsupported returns the unsupported constructs of pkg.
+func (b *Bundler) unsupported(pkg *packages.Package) []UnsupportedIssue {
+	var issues []UnsupportedIssue
+	add := func(pos token.Position, construct string) {
+		issues = append(issues, UnsupportedIssue{Pos: pos, Package: pkg.PkgPath, Construct: construct})
+	}
+
+	var asm bool
+	for _, f := range pkg.OtherFiles {
+		switch filepath.Ext(f) {
+		case ".s", ".S":
+			asm = true
+			add(token.Position{Filename: f}, "assembly file")
+		}
+	}
+
+	// cgo files are compiled into generated files, so the originals are
+	// read again
+	fset := token.NewFileSet()
+	for _, name := range pkg.GoFiles {
+		f, err := parser.ParseFile(fset, name, nil, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		for _, spec := range f.Imports {
+			if path, _ := strconv.Unquote(spec.Path.Value); path == "C" {
+				add(fset.Position(spec.Pos()), `cgo (import "C")`)
+			}
+		}
+	}
+
+	for _, f := range pkg.Syntax {
+		for _, g := range f.Comments {
+			for _, c := range g.List {
+				if c.Text == "//go:linkname" || strings.HasPrefix(c.Text, "//go:linkname ") {
+					add(pkg.Fset.Position(c.Pos()), "//go:linkname")
+				}
+			}
+		}
+	}
+
+	if asm {
+		if fallback := b.puregoFallback(pkg); fallback != "" {
+			for i := range issues {
+				if issues[i].Construct == "assembly file" {
+					issues[i].Fallback = fallback
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// puregoFallback returns the ignored Go file of pkg built only with the
+// purego tag, if any. Files are matched as the go command does, by their
+// build constraints and name, for the target system of the options.
+func (b *Bundler) puregoFallback(pkg *packages.Package) string {
+	ctxt := build.Default
+	if b.opts.GOOS != "" {
+		ctxt.GOOS = b.opts.GOOS
+	}
+	if b.opts.GOARCH != "" {
+		ctxt.GOARCH = b.opts.GOARCH
+	}
+	tags := slices.DeleteFunc(slices.Clone(b.opts.Tags), func(tag string) bool { return tag == "purego" })
+	matches := func(dir, name string, purego bool) bool {
+		ctxt.BuildTags = tags
+		if purego {
+			ctxt.BuildTags = append(slices.Clip(tags), "purego")
+		}
+		ok, err := ctxt.MatchFile(dir, name)
+		return err == nil && ok
+	}
+
+	for _, path := range pkg.IgnoredFiles {
+		if filepath.Ext(path) != ".go" {
+			continue
+		}
+		dir, name := filepath.Split(path)
+		if matches(dir, name, true) && !matches(dir, name, false) {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,235 @@
+package bundler
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/printer"
+	"go/token"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// printBundle writes the bundled file. Declarations come from many files and
+// are reordered, so each one is printed on its own, below its position
+// comment if annotated so, together with the comments found in its original
+// source when opts.Comments is set. Otherwise it is printed without any
+// comment.
+func (b *Bundler) printBundle(w io.Writer) error {
+	fset := b.mainPkg.Fset
+	fmt.Fprintln(w, generatedHeader)
+	fmt.Fprintln(w)
+	if b.opts.Comments {
+		for _, l := range b.licenses() {
+			fmt.Fprintf(w, "%s\n\n", l)
+		}
+	}
+	fmt.Fprintln(w, "package main")
+
+	for _, decl := range b.bundled.Decls {
+		fmt.Fprintln(w)
+		if pos, ok := b.declPos[decl]; ok && b.posComments() {
+			file, line, col := posLabel(fset, b.pkgPaths, pos)
+			fmt.Fprintf(w, "// %s:%d:%d\n", file, line, col)
+		}
+		if !b.opts.Comments {
+			stripComments(decl)
+			if err := format.Node(w, fset, decl); err != nil {
+				return err
+			}
+			fmt.Fprintln(w)
+			continue
+		}
+
+		if d, ok := decl.(*ast.GenDecl); ok && !d.Lparen.IsValid() {
+			// the keyword goes below the doc comment of the spec
+			d.TokPos = d.Specs[0].Pos()
+		}
+		// the printer only prints the comments within the declaration, so
+		// those trailing its last line are appended by hand
+		comments := b.declComments(decl)
+		var trailing []string
+		for len(comments) > 0 && comments[len(comments)-1].Pos() >= decl.End() {
+			g := comments[len(comments)-1]
+			comments = comments[:len(comments)-1]
+			for _, c := range slices.Backward(g.List) {
+				trailing = append(trailing, c.Text)
+			}
+		}
+		slices.Reverse(trailing)
+		node := &printer.CommentedNode{Node: decl, Comments: comments}
+		if err := format.Node(w, fset, node); err != nil {
+			return err
+		}
+		for _, text := range trailing {
+			fmt.Fprintf(w, " %s", text)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// posComments reports whether declarations are annotated with position
+// comments.
+func (b *Bundler) posComments() bool {
+	return b.opts.Annotate == "" || b.opts.Annotate == AnnotateComment
+}
+
+// declComments returns the comments of the original source within decl: its
+// doc comment, the doc and line comments of the specs it kept and those in
+// function bodies.
+func (b *Bundler) declComments(decl ast.Decl) []*ast.CommentGroup {
+	fset := b.mainPkg.Fset
+
+	// spans from the doc comment to the end of the line
+	type span struct{ from, to token.Pos }
+	var spans []span
+	add := func(doc *ast.CommentGroup, n ast.Node) {
+		from, to := n.Pos(), n.End()
+		if doc != nil {
+			from = doc.Pos()
+		}
+		if vs, ok := n.(*ast.ValueSpec); ok {
+			if v, ok := b.embeds[vs]; ok {
+				// the inlined literal is longer than the source it replaces
+				to = v.end
+			}
+		}
+		if from.IsValid() && to.IsValid() {
+			spans = append(spans, span{from, to})
+		}
+	}
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		add(d.Doc, d)
+	case *ast.GenDecl:
+		// a doc moved to the spec is spanned with it
+		if d.Doc != nil && !slices.ContainsFunc(d.Specs, func(s ast.Spec) bool {
+			return specDoc(s) == d.Doc
+		}) {
+			add(nil, d.Doc)
+		}
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				add(s.Doc, s)
+			case *ast.ValueSpec:
+				add(s.Doc, s)
+			}
+		}
+	}
+
+	var ret []*ast.CommentGroup
+	for _, sp := range spans {
+		file := b.files[filepath.ToSlash(fset.Position(sp.from).Filename)]
+		if file == nil {
+			continue
+		}
+		endLine := fset.Position(sp.to).Line
+		for _, g := range file.Comments {
+			if g.Pos() < sp.from {
+				continue
+			}
+			if g.Pos() > sp.to && fset.Position(g.Pos()).Line != endLine {
+				break
+			}
+			if !slices.Contains(ret, g) {
+				ret = append(ret, g)
+			}
+		}
+	}
+	slices.SortFunc(ret, func(x, y *ast.CommentGroup) int { return int(x.Pos() - y.Pos()) })
+	return ret
+}
+
+// specDoc returns the doc comment of a type or value spec.
+func specDoc(spec ast.Spec) *ast.CommentGroup {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return s.Doc
+	case *ast.ValueSpec:
+		return s.Doc
+	}
+	return nil
+}
+
+// licenses returns the license headers of the library packages, the comments
+// above the package clause other than the package doc, each once and
+// preceded by the packages it applies to.
+func (b *Bundler) licenses() []string {
+	var texts []string
+	pkgs := make(map[string][]string)
+	for _, pkg := range b.topoPkgs {
+		if pkg == b.mainPkg {
+			continue
+		}
+		text := licenseHeader(pkg.Syntax)
+		if text == "" {
+			continue
+		}
+		if _, ok := pkgs[text]; !ok {
+			texts = append(texts, text)
+		}
+		pkgs[text] = append(pkgs[text], pkg.PkgPath)
+	}
+
+	ret := make([]string, 0, len(texts))
+	for _, text := range texts {
+		ret = append(ret, fmt.Sprintf("// %s:\n%s", strings.Join(pkgs[text], ", "), text))
+	}
+	return ret
+}
+
+// licenseHeader returns the first comment above the package clause of files
+// that is neither the package doc nor a build constraint.
+func licenseHeader(files []*ast.File) string {
+	for _, f := range files {
+		for _, g := range f.Comments {
+			if g.Pos() >= f.Package {
+				break
+			}
+			if g == f.Doc || isDirectiveGroup(g) || strings.HasPrefix(g.List[0].Text, "// Code generated") {
+				continue
+			}
+			lines := make([]string, 0, len(g.List))
+			for _, c := range g.List {
+				lines = append(lines, c.Text)
+			}
+			return strings.Join(lines, "\n")
+		}
+	}
+	return ""
+}
+
+// stripComments removes the doc and line comments attached to the nodes of
+// decl, which the printer prints when not given the comments to print.
+func stripComments(decl ast.Decl) {
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			n.Doc = nil
+		case *ast.GenDecl:
+			n.Doc = nil
+		case *ast.TypeSpec:
+			n.Doc, n.Comment = nil, nil
+		case *ast.ValueSpec:
+			n.Doc, n.Comment = nil, nil
+		case *ast.Field:
+			n.Doc, n.Comment = nil, nil
+		}
+		return true
+	})
+}
+
+// isDirectiveGroup reports whether g only holds directives such as
+// //go:build.
+func isDirectiveGroup(g *ast.CommentGroup) bool {
+	for _, c := range g.List {
+		if !strings.HasPrefix(c.Text, "//go:") && !strings.HasPrefix(c.Text, "// +build") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package bundler
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// profile is the build context and Go version of a judge.
+type profile struct {
+	// Tags are build tags, the judge name, so that files can be guarded by
+	// //go:build atcoder.
+	Tags     []string
+	GOOS     string
+	GOARCH   string
+	TargetGo string
+}
+
+// profiles are the judges Options.Profile may name.
+var profiles = map[string]profile{
+	"atcoder": {
+		Tags:     []string{"atcoder"},
+		GOOS:     "linux",
+		GOARCH:   "amd64",
+		TargetGo: "1.20",
+	},
+	"codeforces": {
+		Tags:     []string{"codeforces"},
+		GOOS:     "windows",
+		GOARCH:   "amd64",
+		TargetGo: "1.22",
+	},
+}
+
+// applyProfile returns opts with the settings of opts.Profile it leaves
+// empty. Its tags are added to those of opts.
+func applyProfile(opts Options) (Options, error) {
+	if opts.Profile == "" {
+		return opts, nil
+	}
+	p, ok := profiles[opts.Profile]
+	if !ok {
+		names := slices.Sorted(maps.Keys(profiles))
+		return opts, fmt.Errorf("unknown profile %q, want %s", opts.Profile, strings.Join(names, " or "))
+	}
+	opts.Tags = slices.Concat(p.Tags, opts.Tags)
+	if opts.GOOS == "" {
+		opts.GOOS = p.GOOS
+	}
+	if opts.GOARCH == "" {
+		opts.GOARCH = p.GOARCH
+	}
+	if opts.TargetGo == "" {
+		opts.TargetGo = p.TargetGo
+	}
+	return opts, nil
+}
@@ -0,0 +1,160 @@
+package bundler
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// pruneConstDecl returns decl without its unreachable constants, or nil if
+// none is reachable.
+//
+// A spec without values repeats the type and values of the last spec with
+// values, and iota is the index of the spec in the group. Specs are kept as
+// written until the first one is pruned. After it, iota is replaced by its
+// value and specs repeating values get copies of the values they repeat,
+// since the spec holding them may be gone. The values are repeated rather
+// than computed, so that they keep their exact value and default type. The
+// line comment of such a spec is dropped from file: the printer places it by
+// its column in the source, which the prefixed name before the values passes.
+func pruneConstDecl(info *types.Info, file *ast.File, decl *ast.GenDecl, reachable map[types.Object]bool) *ast.GenDecl {
+	isReachable := func(name *ast.Ident) bool {
+		obj, ok := info.Defs[name]
+		return ok && isPkgLevelConst(obj) && reachable[obj]
+	}
+
+	pruned := *decl
+	pruned.Specs = nil
+	changed := false
+	// the last spec with values
+	var last *ast.ValueSpec
+	for i, spec := range decl.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		repeated := len(vs.Values) == 0
+		if !repeated {
+			last = vs
+		} else if last == nil || len(last.Values) != len(vs.Names) {
+			// not a valid group, which is better left as written
+			return decl
+		}
+
+		var names []*ast.Ident
+		var values []ast.Expr
+		for j, name := range vs.Names {
+			if !isReachable(name) {
+				continue
+			}
+			names = append(names, name)
+			if j < len(last.Values) {
+				values = append(values, last.Values[j])
+			}
+		}
+		if len(names) == 0 {
+			changed = true
+			continue
+		}
+
+		if !changed && len(names) == len(vs.Names) {
+			pruned.Specs = append(pruned.Specs, vs)
+			continue
+		}
+		// the values may be repeated by the specs that follow, which
+		// replace iota by other values, so they are copied. Repeated ones
+		// are moved to the spec repeating them.
+		typ, pos, comment := vs.Type, token.NoPos, vs.Comment
+		if repeated {
+			pos = vs.Pos()
+			typ = copyExpr(info, last.Type, pos)
+			if comment != nil {
+				file.Comments = slices.DeleteFunc(file.Comments, func(g *ast.CommentGroup) bool { return g == comment })
+				comment = nil
+			}
+		}
+		for j := range values {
+			values[j] = replaceIota(info, copyExpr(info, values[j], pos), i)
+		}
+		pruned.Specs = append(pruned.Specs, &ast.ValueSpec{
+			Doc:     vs.Doc,
+			Names:   names,
+			Type:    typ,
+			Values:  values,
+			Comment: comment,
+		})
+		changed = true
+	}
+
+	if len(pruned.Specs) == 0 {
+		return nil
+	}
+	if len(pruned.Specs) == 1 {
+		pruned.Lparen, pruned.Rparen = token.NoPos, token.NoPos
+	}
+	return &pruned
+}
+
+// copyExpr returns a deep copy of e, recording the type information of e for
+// the copy. If pos is valid, the positions set in the copy are moved to it.
+func copyExpr(info *types.Info, e ast.Expr, pos token.Pos) ast.Expr {
+	if e == nil {
+		return nil
+	}
+	nodes := make(map[ast.Node]ast.Node)
+	c := cloneNode(e, nodes).(ast.Expr)
+	for n, cn := range nodes {
+		if pos.IsValid() {
+			setPos(cn, pos)
+		}
+		if e, ok := n.(ast.Expr); ok {
+			if tv, ok := info.Types[e]; ok {
+				info.Types[cn.(ast.Expr)] = tv
+			}
+		}
+		if id, ok := n.(*ast.Ident); ok {
+			if obj, ok := info.Uses[id]; ok {
+				info.Uses[cn.(*ast.Ident)] = obj
+			}
+			if inst, ok := info.Instances[id]; ok {
+				info.Instances[cn.(*ast.Ident)] = inst
+			}
+		}
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if s, ok := info.Selections[sel]; ok {
+				info.Selections[cn.(*ast.SelectorExpr)] = s
+			}
+		}
+	}
+	return c
+}
+
+// replaceIota replaces iota in e by its value in the spec at index.
+func replaceIota(info *types.Info, e ast.Expr, index int) ast.Expr {
+	return astutil.Apply(e, func(c *astutil.Cursor) bool {
+		id, ok := c.Node().(*ast.Ident)
+		if !ok || info.Uses[id] != types.Universe.Lookup("iota") {
+			return true
+		}
+		c.Replace(&ast.BasicLit{ValuePos: id.Pos(), Kind: token.INT, Value: strconv.Itoa(index)})
+		return false
+	}, nil).(ast.Expr)
+}
+
+var posType = reflect.TypeFor[token.Pos]()
+
+// setPos sets the positions held by the node n itself to pos. Those not set
+// are left so, as some, like the ellipsis of a call, tell the syntax apart.
+func setPos(n ast.Node, pos token.Pos) {
+	v := reflect.ValueOf(n).Elem()
+	for i := range v.NumField() {
+		if f := v.Field(i); f.Type() == posType && token.Pos(f.Int()).IsValid() {
+			f.Set(reflect.ValueOf(pos))
+		}
+	}
+}
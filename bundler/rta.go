@@ -0,0 +1,575 @@
+package bundler
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/rta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+func AnalyzeReachableDecls(main *packages.Package, topoPkg []*packages.Package) map[types.Object]bool {
+	return analyzeReachability(main, topoPkg).reachableDecls
+}
+
+// analyzeReachability runs the analysis and keeps the analyzer, which also
+// records why each declaration is reachable.
+func analyzeReachability(main *packages.Package, topoPkg []*packages.Package) *ReachabilityAnalyzer {
+	a := &ReachabilityAnalyzer{
+		mainPkg:   main,
+		topoPkgs:  topoPkg,
+		declRoots: make(map[types.Object]bool, 128),
+		declGraph: make(map[types.Object][]declEdge, 128),
+		pkgInits:  make(map[*types.Package]types.Object),
+	}
+	a.buildSSA()
+	a.analyzeRTA()
+	a.buildNodeToFn()
+	a.collectReferencedDecls()
+	// call edges first, so that called functions are reported as such
+	a.addCallEdges()
+	a.buildDeclGraph()
+	a.addMethodRequirements()
+	a.addInitializerEdges()
+	a.propagateDeclReachability()
+	return a
+}
+
+// declEdge is an edge of the declaration graph, labeled with why it makes
+// its target reachable.
+type declEdge struct {
+	to     types.Object
+	reason Reason
+}
+
+type ReachabilityAnalyzer struct {
+	// input
+	mainPkg  *packages.Package
+	topoPkgs []*packages.Package
+
+	// cache
+	prog        *ssa.Program
+	ssaPkgs     []*ssa.Package
+	reachableFn map[*ssa.Function]bool
+	nodeToFn    map[ast.Node]*ssa.Function
+	declGraph   map[types.Object][]declEdge
+	declRoots   map[types.Object]bool
+	callGraph   *callgraph.Graph
+	roots       []*ssa.Function
+	// runtimeTypes are the types RTA found converted to interfaces
+	runtimeTypes []types.Type
+	// pkgInits stand for the synthetic initializers of packages
+	pkgInits map[*types.Package]types.Object
+	msets    typeutil.MethodSetCache
+	// reflection is set if methods may be called by reflection
+	reflection bool
+
+	// output
+	reachableDecls map[types.Object]bool
+	// parents and reasons record the BFS tree of propagateDeclReachability
+	parents map[types.Object]types.Object
+	reasons map[types.Object]Reason
+}
+
+func (a *ReachabilityAnalyzer) buildSSA() {
+	prog, ssaPkgs := ssautil.AllPackages([]*packages.Package{a.mainPkg}, ssa.InstantiateGenerics)
+	prog.Build()
+
+	// cache
+	a.prog = prog
+	a.ssaPkgs = ssaPkgs
+}
+
+func (a *ReachabilityAnalyzer) analyzeRTA() {
+	roots := rootsPkgs(a.ssaPkgs)
+	res := rta.Analyze(roots, true)
+	if res == nil {
+		panic("res is nil")
+	}
+	// RTA keeps every exported method of runtime types in case it is called
+	// by reflection. Follow the call graph instead unless the program looks
+	// methods up by reflection.
+	called := calledFuncs(res.CallGraph, roots)
+	reachable := called
+	for fn := range called {
+		if isMethodReflection(fn) {
+			reachable = make(map[*ssa.Function]bool, len(res.Reachable))
+			for fn := range res.Reachable {
+				reachable[fn] = true
+			}
+			a.reflection = true
+			break
+		}
+	}
+	a.reachableFn = reachable
+	a.runtimeTypes = res.RuntimeTypes.Keys()
+	a.callGraph = res.CallGraph
+	a.roots = roots
+}
+
+// calledFuncs returns the functions called transitively from roots.
+func calledFuncs(cg *callgraph.Graph, roots []*ssa.Function) map[*ssa.Function]bool {
+	called := make(map[*ssa.Function]bool, len(cg.Nodes))
+	queue := make([]*callgraph.Node, 0, len(roots))
+	for _, fn := range roots {
+		if n := cg.Nodes[fn]; n != nil {
+			queue = append(queue, n)
+		}
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if called[n.Func] {
+			continue
+		}
+		called[n.Func] = true
+		for _, e := range n.Out {
+			queue = append(queue, e.Callee)
+		}
+	}
+	return called
+}
+
+// isMethodReflection reports whether fn looks up methods by reflection.
+func isMethodReflection(fn *ssa.Function) bool {
+	if fn.Pkg == nil || fn.Pkg.Pkg.Path() != "reflect" {
+		return false
+	}
+	switch fn.Name() {
+	case "Method", "MethodByName":
+		return true
+	}
+	return false
+}
+
+func (a *ReachabilityAnalyzer) buildNodeToFn() {
+	a.nodeToFn = make(map[ast.Node]*ssa.Function, 128)
+	for _, ssaPkg := range a.ssaPkgs {
+		for _, mem := range ssaPkg.Members {
+			if fn, ok := mem.(*ssa.Function); ok {
+				if syn := fn.Syntax(); syn != nil {
+					a.nodeToFn[syn] = fn
+				}
+			}
+		}
+	}
+}
+
+func (a *ReachabilityAnalyzer) collectReferencedDecls() {
+	for _, p := range a.topoPkgs {
+		info := p.TypesInfo
+		if info == nil {
+			continue
+		}
+		for _, f := range p.Syntax {
+			v := &declUseVisitor{
+				info:          info,
+				nodeToFn:      a.nodeToFn,
+				reachableFunc: a.reachableFn,
+				reachableDecl: a.declRoots,
+			}
+			ast.Walk(v, f)
+		}
+	}
+}
+
+func (a *ReachabilityAnalyzer) buildDeclGraph() {
+	for _, p := range a.topoPkgs {
+		info := p.TypesInfo
+		if info == nil {
+			continue
+		}
+
+		for _, f := range p.Syntax {
+			for _, decl := range f.Decls {
+				switch d := decl.(type) {
+				case *ast.FuncDecl:
+					obj := info.Defs[d.Name]
+					if obj != nil {
+						a.inspectDeclBody(info, []types.Object{obj}, d)
+					}
+				case *ast.GenDecl:
+					switch d.Tok {
+					case token.TYPE:
+						for _, spec := range d.Specs {
+							if ts, ok := spec.(*ast.TypeSpec); ok {
+								if obj := info.Defs[ts.Name]; obj != nil {
+									a.inspectDeclBody(info, []types.Object{obj}, d)
+								}
+							}
+						}
+					case token.VAR, token.CONST:
+						// a const spec without values repeats the type and
+						// values of the last one with values
+						var last *ast.ValueSpec
+						for _, spec := range d.Specs {
+							if vs, ok := spec.(*ast.ValueSpec); ok {
+								var curDecls []types.Object
+								for _, name := range vs.Names {
+									if obj := info.Defs[name]; obj != nil {
+										curDecls = append(curDecls, obj)
+									}
+								}
+								if len(vs.Values) > 0 {
+									last = vs
+								}
+								if len(curDecls) > 0 {
+									a.inspectDeclBody(info, curDecls, vs)
+									if d.Tok == token.CONST && len(vs.Values) == 0 && last != nil {
+										a.inspectDeclBody(info, curDecls, last)
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func (a *ReachabilityAnalyzer) inspectDeclBody(info *types.Info, parents []types.Object, root ast.Node) {
+	ast.Inspect(root, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if obj := info.Uses[id]; obj != nil {
+				for _, p := range parents {
+					a.addEdge(p, obj, referenceReason(p, obj))
+				}
+			}
+			// type arguments need the methods of their constraints
+			if inst, ok := info.Instances[id]; ok {
+				for _, m := range a.constraintMethods(info.Uses[id], inst) {
+					for _, p := range parents {
+						a.addEdge(p, m, ReasonInterface)
+					}
+				}
+			}
+		}
+		return true
+	})
+
+}
+
+func (a *ReachabilityAnalyzer) addEdge(from, to types.Object, reason Reason) {
+	a.declGraph[from] = append(a.declGraph[from], declEdge{to: to, reason: reason})
+}
+
+// referenceReason returns why the declaration from referring to obj makes it
+// reachable.
+func referenceReason(from, obj types.Object) Reason {
+	if _, ok := obj.(*types.TypeName); ok {
+		return ReasonType
+	}
+	if v, ok := from.(*types.Var); ok && isPkgLevelVar(v) {
+		return ReasonInitializer
+	}
+	return ReasonReferenced
+}
+
+// addCallEdges adds the edges of the RTA call graph between declarations.
+// Synthetic functions such as wrappers are looked through.
+func (a *ReachabilityAnalyzer) addCallEdges() {
+	var callees func(n *callgraph.Node, seen map[*callgraph.Node]bool) []types.Object
+	callees = func(n *callgraph.Node, seen map[*callgraph.Node]bool) []types.Object {
+		var ret []types.Object
+		for _, e := range n.Out {
+			if seen[e.Callee] || !a.reachableFn[e.Callee.Func] {
+				continue
+			}
+			seen[e.Callee] = true
+			if decl := a.declOfFunc(e.Callee.Func); decl != nil {
+				ret = append(ret, decl)
+			} else {
+				ret = append(ret, callees(e.Callee, seen)...)
+			}
+		}
+		return ret
+	}
+
+	for fn, n := range a.callGraph.Nodes {
+		if fn == nil || !a.reachableFn[fn] {
+			continue
+		}
+		from := a.declOfFunc(fn)
+		if from == nil {
+			continue
+		}
+		for _, to := range callees(n, map[*callgraph.Node]bool{n: true}) {
+			if to != from {
+				a.addEdge(from, to, ReasonCalled)
+			}
+		}
+	}
+}
+
+// addInitializerEdges adds edges from package initializers to the vars whose
+// initializers call functions. Their side effects are observable even if they
+// are never used.
+func (a *ReachabilityAnalyzer) addInitializerEdges() {
+	for _, v := range initCallRoots(a.topoPkgs) {
+		a.addEdge(a.pkgInit(v.Pkg()), v, ReasonInitializer)
+	}
+}
+
+// constraintMethods returns the methods the type arguments of inst need to
+// satisfy the constraints of the generic obj.
+func (a *ReachabilityAnalyzer) constraintMethods(obj types.Object, inst types.Instance) []types.Object {
+	var tparams *types.TypeParamList
+	switch o := obj.(type) {
+	case *types.Func:
+		tparams = o.Type().(*types.Signature).TypeParams()
+	case *types.TypeName:
+		if named, ok := o.Type().(*types.Named); ok {
+			tparams = named.TypeParams()
+		}
+	}
+	if tparams == nil {
+		return nil
+	}
+
+	var ret []types.Object
+	for i := 0; i < tparams.Len() && i < inst.TypeArgs.Len(); i++ {
+		ret = append(ret, a.interfaceMethods(inst.TypeArgs.At(i), tparams.At(i).Constraint())...)
+	}
+	return ret
+}
+
+// addMethodRequirements adds edges from declarations to the methods their
+// code needs to exist: methods of types converted to interfaces, and of
+// runtime types implementing interfaces asserted to. Methods needed by
+// package initialization become roots.
+func (a *ReachabilityAnalyzer) addMethodRequirements() {
+	for fn := range ssautil.AllFunctions(a.prog) {
+		decl := a.declOfFunc(fn)
+		if decl == nil || decl.Pkg() == nil || !a.isTopoPkg(decl.Pkg()) {
+			continue
+		}
+
+		var required []types.Object
+		for _, block := range fn.Blocks {
+			for _, instr := range block.Instrs {
+				switch v := instr.(type) {
+				case *ssa.MakeInterface:
+					required = append(required, a.interfaceMethods(v.X.Type(), v.Type())...)
+				case *ssa.TypeAssert:
+					if !types.IsInterface(v.AssertedType) {
+						break
+					}
+					it := v.AssertedType.Underlying().(*types.Interface)
+					for _, t := range a.runtimeTypes {
+						if types.Implements(t, it) {
+							required = append(required, a.interfaceMethods(t, it)...)
+						}
+					}
+				}
+			}
+		}
+
+		for _, m := range required {
+			a.addEdge(decl, m, ReasonInterface)
+		}
+	}
+}
+
+// interfaceMethods returns the methods of t named like the methods of iface.
+func (a *ReachabilityAnalyzer) interfaceMethods(t, iface types.Type) []types.Object {
+	it, ok := iface.Underlying().(*types.Interface)
+	if !ok || it.NumMethods() == 0 || types.IsInterface(t) {
+		return nil
+	}
+	mset := a.msets.MethodSet(t)
+	ret := make([]types.Object, 0, it.NumMethods())
+	for i := 0; i < it.NumMethods(); i++ {
+		m := it.Method(i)
+		if sel := mset.Lookup(m.Pkg(), m.Name()); sel != nil {
+			ret = append(ret, sel.Obj())
+		}
+	}
+	return ret
+}
+
+// declOfFunc returns the declared function fn belongs to, or the package
+// initializer for the synthetic init of a package.
+func (a *ReachabilityAnalyzer) declOfFunc(fn *ssa.Function) types.Object {
+	for fn.Parent() != nil {
+		fn = fn.Parent()
+	}
+	if o := fn.Origin(); o != nil {
+		fn = o
+	}
+	if obj := fn.Object(); obj != nil {
+		return origin(obj)
+	}
+	if fn.Pkg != nil && fn.Synthetic == "package initializer" {
+		return a.pkgInit(fn.Pkg.Pkg)
+	}
+	return nil
+}
+
+// pkgInit returns the object standing for the initializer of p.
+func (a *ReachabilityAnalyzer) pkgInit(p *types.Package) types.Object {
+	obj, ok := a.pkgInits[p]
+	if !ok {
+		obj = types.NewFunc(token.NoPos, p, "init", types.NewSignatureType(nil, nil, nil, nil, nil, false))
+		a.pkgInits[p] = obj
+	}
+	return obj
+}
+
+// origin returns the generic declaration of an instantiated obj.
+func origin(obj types.Object) types.Object {
+	switch o := obj.(type) {
+	case *types.Func:
+		return o.Origin()
+	case *types.Var:
+		return o.Origin()
+	}
+	return obj
+}
+
+// propagateDeclReachability walks the declaration graph breadth-first from
+// main and the initializer of the main package, so that the recorded parents
+// form shortest paths.
+func (a *ReachabilityAnalyzer) propagateDeclReachability() {
+	a.reachableDecls = make(map[types.Object]bool, len(a.declRoots))
+	a.parents = make(map[types.Object]types.Object, len(a.declRoots))
+	a.reasons = make(map[types.Object]Reason, len(a.declRoots))
+
+	// seed reachable decls
+	queue := make([]types.Object, 0, len(a.declRoots))
+	for _, fn := range a.roots {
+		if obj := a.declOfFunc(fn); obj != nil {
+			a.reachableDecls[obj] = true
+			a.reasons[obj] = ReasonEntry
+			queue = append(queue, obj)
+		}
+	}
+	if a.reflection {
+		// reachable without being called
+		for fn := range a.reachableFn {
+			obj := a.declOfFunc(fn)
+			if obj == nil || a.reachableDecls[obj] || obj.Pkg() == nil || !a.isTopoPkg(obj.Pkg()) {
+				continue
+			}
+			a.reachableDecls[obj] = true
+			a.reasons[obj] = ReasonReflection
+			queue = append(queue, obj)
+		}
+	}
+
+	// bfs
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:] // pop
+		for _, e := range a.declGraph[cur] {
+			next := origin(e.to)
+			if a.reachableDecls[next] {
+				continue
+			}
+			a.reachableDecls[next] = true
+			a.parents[next] = cur
+			a.reasons[next] = e.reason
+			queue = append(queue, next) // push
+		}
+	}
+}
+
+// isTopoPkg reports whether p is one of the bundled packages.
+func (a *ReachabilityAnalyzer) isTopoPkg(p *types.Package) bool {
+	for _, q := range a.topoPkgs {
+		if q.Types == p {
+			return true
+		}
+	}
+	return false
+}
+
+func rootsPkgs(pkgs []*ssa.Package) []*ssa.Function {
+	roots := make([]*ssa.Function, 0, 128)
+	for _, p := range pkgs {
+		if p == nil || p.Pkg.Name() != "main" {
+			continue
+		}
+		if f := p.Func("init"); f != nil {
+			roots = append(roots, f)
+		}
+		if f := p.Func("main"); f != nil {
+			roots = append(roots, f)
+		}
+
+	}
+	return roots
+}
+
+type declUseVisitor struct {
+	info          *types.Info
+	nodeToFn      map[ast.Node]*ssa.Function
+	reachableFunc map[*ssa.Function]bool
+	reachableDecl map[types.Object]bool
+
+	// Visitの処理で今見ているnodeの全祖先をstackで管理している
+	stack []ast.Node
+	// stackに貯められた祖先の中で、reachableな関数のstackスライスでのindexを持っている
+	fnStack []*ssa.Function
+}
+
+func (v *declUseVisitor) push(n ast.Node) {
+	v.stack = append(v.stack, n)
+	if fn, ok := v.nodeToFn[n]; ok {
+		v.fnStack = append(v.fnStack, fn)
+	}
+}
+
+func (v *declUseVisitor) pop() {
+	if len(v.stack) == 0 {
+		return
+	}
+
+	poped := v.stack[len(v.stack)-1]
+	v.stack = v.stack[:len(v.stack)-1]
+
+	if fn, ok := v.nodeToFn[poped]; ok && len(v.fnStack) > 0 {
+		if v.fnStack[len(v.fnStack)-1] == fn {
+			v.fnStack = v.fnStack[:len(v.fnStack)-1]
+		}
+	}
+}
+
+func (v *declUseVisitor) curFn() *ssa.Function {
+	if len(v.fnStack) == 0 {
+		return nil
+	}
+	return v.fnStack[len(v.fnStack)-1]
+}
+
+func (v *declUseVisitor) Visit(n ast.Node) ast.Visitor {
+	// nがnilなのはそのサブツリーを抜ける時
+	if n == nil {
+		v.pop()
+		return v
+	}
+
+	// nodeに入るタイミング
+	v.push(n)
+
+	// reachableな関数で利用のある要素なら、reachableDeclに追加
+	id, ok := n.(*ast.Ident)
+	if !ok {
+		return v
+	}
+
+	obj := v.info.Uses[id]
+	if obj == nil {
+		return v
+	}
+
+	if cur := v.curFn(); cur != nil || v.reachableFunc[cur] {
+		v.reachableDecl[obj] = true
+	}
+	return v
+}
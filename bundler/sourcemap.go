@@ -0,0 +1,288 @@
+package bundler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SourceMap maps lines of a bundled file back to the original sources.
+type SourceMap struct {
+	// LineDirectives reports whether the bundled file has //line directives,
+	// so that its stack traces and compiler errors already hold the
+	// original positions.
+	LineDirectives bool             `json:"line_directives,omitempty"`
+	Entries        []SourceMapEntry `json:"entries"`
+}
+
+// SourceMapEntry maps the lines of one bundled declaration.
+type SourceMapEntry struct {
+	// Start and End are the first and last line of the declaration in the
+	// bundled file.
+	Start int `json:"start"`
+	End   int `json:"end"`
+
+	// File, Line and Col are the original position of the declaration.
+	// File is the package path joined with the file name, or the file path
+	// of a //line directive, which has no column.
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Col  int    `json:"col,omitempty"`
+}
+
+// ReadSourceMap reads a SourceMap written by WriteJSON.
+func ReadSourceMap(r io.Reader) (*SourceMap, error) {
+	var m SourceMap
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("source map: %w", err)
+	}
+	return &m, nil
+}
+
+// WriteJSON writes m as indented JSON.
+func (m *SourceMap) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(m)
+}
+
+// posComment matches the position comments written by printBundle.
+var posComment = regexp.MustCompile(`^// (\S+\.go):(\d+):(\d+)$`)
+
+// lineDirective matches the //line directives written by lineDirectives.
+var lineDirective = regexp.MustCompile(`^//line (.+\.go):(\d+)$`)
+
+// bundledFile is the name //line directives give to the bundled file itself.
+const bundledFile = "main.go"
+
+// ParseSourceMap builds a SourceMap from the position comments or the //line
+// directives of a bundled file.
+func ParseSourceMap(src []byte) (*SourceMap, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	return sourceMapOf(fset, file), nil
+}
+
+func sourceMapOf(fset *token.FileSet, file *ast.File) *SourceMap {
+	// the parser attaches doc comments by adjusted lines, so //line
+	// directives are found by the line below them instead
+	directives := make(map[int]*ast.Comment)
+	for _, g := range file.Comments {
+		for _, c := range g.List {
+			if lineDirective.MatchString(c.Text) {
+				directives[fset.PositionFor(c.Pos(), false).Line+1] = c
+			}
+		}
+	}
+
+	m := &SourceMap{LineDirectives: len(directives) > 0}
+	for _, decl := range file.Decls {
+		start := fset.PositionFor(decl.Pos(), false).Line
+		var comments []*ast.Comment
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Doc != nil {
+				comments = d.Doc.List
+			}
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				comments = d.Doc.List
+			}
+		}
+
+		for _, c := range comments {
+			match := posComment.FindStringSubmatch(c.Text)
+			if match == nil {
+				continue
+			}
+			line, _ := strconv.Atoi(match[2])
+			col, _ := strconv.Atoi(match[3])
+			m.Entries = append(m.Entries, SourceMapEntry{
+				Start: start,
+				End:   fset.PositionFor(decl.End(), false).Line,
+				File:  match[1],
+				Line:  line,
+				Col:   col,
+			})
+		}
+		if c, ok := directives[start]; ok {
+			match := lineDirective.FindStringSubmatch(c.Text)
+			if match[1] == bundledFile {
+				continue
+			}
+			line, _ := strconv.Atoi(match[2])
+			m.Entries = append(m.Entries, SourceMapEntry{
+				Start: start,
+				End:   fset.PositionFor(decl.End(), false).Line,
+				File:  match[1],
+				Line:  line,
+			})
+		}
+	}
+	return m
+}
+
+// sourceMap maps the declarations of the formatted bundled source to the
+// original positions recorded while building the file. Unlike ParseSourceMap
+// it does not depend on position comments.
+func (b *Bundler) sourceMap(src []byte) (*SourceMap, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// goimports may rewrite import decls, all others keep their order
+	got := nonImportDecls(file.Decls)
+	orig := nonImportDecls(b.bundled.Decls)
+	if len(got) != len(orig) {
+		return nil, fmt.Errorf("source map: %d declarations in output, %d bundled", len(got), len(orig))
+	}
+
+	m := &SourceMap{LineDirectives: b.opts.Annotate == AnnotateLine}
+	for i, decl := range got {
+		pos, ok := b.declPos[orig[i]]
+		if !ok {
+			// synthetic
+			continue
+		}
+		file, line, col := posLabel(b.mainPkg.Fset, b.pkgPaths, pos)
+		m.Entries = append(m.Entries, SourceMapEntry{
+			Start: fset.PositionFor(decl.Pos(), false).Line,
+			End:   fset.PositionFor(decl.End(), false).Line,
+			File:  file,
+			Line:  line,
+			Col:   col,
+		})
+	}
+	return m, nil
+}
+
+// lineDirectives inserts a //line directive with the original file and line
+// above the keyword of each declaration of the formatted bundled source.
+// Generated declarations following one are mapped back to the bundled file.
+func (b *Bundler) lineDirectives(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	got := nonImportDecls(file.Decls)
+	orig := nonImportDecls(b.bundled.Decls)
+	if len(got) != len(orig) {
+		return nil, fmt.Errorf("line directives: %d declarations in output, %d bundled", len(got), len(orig))
+	}
+
+	// directives by the offset of the line they go above
+	directives := make(map[int]string, len(got))
+	offsets := make([]int, 0, len(got))
+	for i, decl := range got {
+		pos := fset.Position(decl.Pos())
+		lineStart := pos.Offset - (pos.Column - 1)
+		if p, ok := b.declPos[orig[i]]; ok {
+			op := b.mainPkg.Fset.Position(p)
+			directives[lineStart] = fmt.Sprintf("//line %s:%d", op.Filename, op.Line)
+		} else if len(offsets) > 0 {
+			// the line number is known once the directives above are counted
+			directives[lineStart] = ""
+		} else {
+			continue
+		}
+		offsets = append(offsets, lineStart)
+	}
+
+	var buf bytes.Buffer
+	prev := 0
+	for i, off := range offsets {
+		buf.Write(src[prev:off])
+		prev = off
+		d := directives[off]
+		if d == "" {
+			line := bytes.Count(src[:off], []byte("\n")) + 1
+			d = fmt.Sprintf("//line %s:%d", bundledFile, line+i+1)
+		}
+		buf.WriteString(d + "\n")
+	}
+	buf.Write(src[prev:])
+	return buf.Bytes(), nil
+}
+
+func nonImportDecls(decls []ast.Decl) []ast.Decl {
+	ret := make([]ast.Decl, 0, len(decls))
+	for _, d := range decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			continue
+		}
+		ret = append(ret, d)
+	}
+	return ret
+}
+
+// posLabel returns the package path joined with the file name, the line and
+// the column of pos.
+func posLabel(fset *token.FileSet, filePkgMap map[string]pkgPath, t token.Pos) (string, int, int) {
+	pos := fset.Position(t)
+	fp := filepath.ToSlash(pos.Filename)
+	pp, ok := filePkgMap[fp]
+	if !ok {
+		pp = "unknown"
+	}
+	return path.Join(string(pp), filepath.Base(fp)), pos.Line, pos.Column
+}
+
+// Lookup returns the original position of a line in the bundled file.
+// Only file and line are known, the column is left zero.
+func (m *SourceMap) Lookup(line int) (token.Position, bool) {
+	for _, e := range m.Entries {
+		if e.Start <= line && line <= e.End {
+			return token.Position{
+				Filename: e.File,
+				Line:     e.Line + line - e.Start,
+			}, true
+		}
+	}
+	return token.Position{}, false
+}
+
+// tracePos matches the file:line positions, with an optional column, of
+// stack traces and compiler errors.
+var tracePos = regexp.MustCompile(`[^\s():]*\.go:(\d+)(?::\d+)?`)
+
+// Remap rewrites the positions in the bundled file named name found in text,
+// such as a stack trace or compiler errors, to the original positions. The
+// directory is ignored and the name compared case-insensitively, since judges
+// rename submissions, such as to Main.go. Columns are dropped, as renaming
+// shifts them. Positions outside of the bundled declarations are left as is,
+// and so is all of text if the bundled file has //line directives: its
+// positions are original already, and the main package may well have a
+// main.go of its own.
+func (m *SourceMap) Remap(text, name string) string {
+	if m.LineDirectives {
+		return text
+	}
+	return tracePos.ReplaceAllStringFunc(text, func(s string) string {
+		match := tracePos.FindStringSubmatch(s)
+		file := s[:strings.LastIndex(s, ".go:")+len(".go")]
+		if !strings.EqualFold(path.Base(strings.ReplaceAll(file, `\`, "/")), name) {
+			return s
+		}
+		line, _ := strconv.Atoi(match[1])
+		pos, ok := m.Lookup(line)
+		if !ok {
+			return s
+		}
+		return fmt.Sprintf("%s:%d", pos.Filename, pos.Line)
+	})
+}
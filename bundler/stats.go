@@ -0,0 +1,148 @@
+package bundler
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+)
+
+// Stats breaks the size of the bundled source down by package and
+// declaration kind.
+type Stats struct {
+	// Total is the size of the whole source.
+	Total Size
+
+	// Other is the size of everything not declared by a bundled package:
+	// the header, imports, generated helpers and blank lines between
+	// declarations.
+	Other Size
+
+	// Packages are in the order of Result.Packages.
+	Packages []PackageStats
+}
+
+// Size is a byte and line count. The lines of a declaration include its
+// doc comment.
+type Size struct {
+	Bytes int
+	Lines int
+}
+
+func (s *Size) add(t Size) {
+	s.Bytes += t.Bytes
+	s.Lines += t.Lines
+}
+
+// PackageStats is the contribution of one package to the bundled source.
+type PackageStats struct {
+	Package string
+
+	// Size is the sum of the sizes by kind.
+	Size    Size
+	Types   Size
+	Funcs   Size
+	Methods Size
+	Consts  Size
+	Vars    Size
+
+	// Reachable counts the bundled package-level declarations out of Total,
+	// methods included.
+	Reachable int
+	Total     int
+}
+
+// stats measures the declarations of the formatted bundled source, matched
+// to the bundled declarations as in sourceMap, which already checked that
+// they line up.
+func (b *Bundler) stats(src []byte) (Stats, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	st := Stats{Total: Size{Bytes: len(src), Lines: bytes.Count(src, []byte("\n"))}}
+	index := make(map[pkgPath]int, len(b.topoPkgs))
+	for i, pkg := range b.topoPkgs {
+		index[pkgPath(pkg.PkgPath)] = i
+		ps := PackageStats{Package: pkg.PkgPath}
+		for _, obj := range pkgDecls(pkg) {
+			ps.Total++
+			if b.analysis.reachableDecls[obj] {
+				ps.Reachable++
+			}
+		}
+		st.Packages = append(st.Packages, ps)
+	}
+
+	got := nonImportDecls(file.Decls)
+	orig := nonImportDecls(b.bundled.Decls)
+	sum := Size{}
+	for i, decl := range got {
+		pp, ok := b.declPkg(orig[i])
+		if !ok {
+			continue
+		}
+		j, ok := index[pp]
+		if !ok {
+			continue
+		}
+		size := declSize(fset, decl)
+		ps := &st.Packages[j]
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil {
+				ps.Methods.add(size)
+			} else {
+				ps.Funcs.add(size)
+			}
+		case *ast.GenDecl:
+			switch d.Tok {
+			case token.TYPE:
+				ps.Types.add(size)
+			case token.CONST:
+				ps.Consts.add(size)
+			case token.VAR:
+				ps.Vars.add(size)
+			}
+		}
+		ps.Size.add(size)
+		sum.add(size)
+	}
+	st.Other = Size{Bytes: st.Total.Bytes - sum.Bytes, Lines: st.Total.Lines - sum.Lines}
+	return st, nil
+}
+
+// declSize measures decl from its doc comment to its end, with the newline
+// ending it.
+func declSize(fset *token.FileSet, decl ast.Decl) Size {
+	start := decl.Pos()
+	switch d := decl.(type) {
+	case *ast.GenDecl:
+		if d.Doc != nil {
+			start = d.Doc.Pos()
+		}
+	case *ast.FuncDecl:
+		if d.Doc != nil {
+			start = d.Doc.Pos()
+		}
+	}
+	from, to := fset.PositionFor(start, false), fset.PositionFor(decl.End(), false)
+	return Size{
+		Bytes: to.Offset - from.Offset + 1,
+		Lines: to.Line - from.Line + 1,
+	}
+}
+
+// declPkg returns the package a bundled declaration comes from. Synthetic
+// declarations have none.
+func (b *Bundler) declPkg(decl ast.Decl) (pkgPath, bool) {
+	pos, ok := b.declPos[decl]
+	if !ok {
+		return "", false
+	}
+	pp, ok := b.pkgPaths[filepath.ToSlash(b.mainPkg.Fset.Position(pos).Filename)]
+	return pp, ok
+}
@@ -1,4 +1,4 @@
-package main
+package bundler
 
 import (
 	"golang.org/x/tools/go/packages"
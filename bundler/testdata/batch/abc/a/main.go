@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/batch/abc/lib"
+)
+
+func main() {
+	fmt.Println("a", lib.Double(21))
+}
@@ -0,0 +1,11 @@
+package lib
+
+var factor int
+
+func init() {
+	factor = 2
+}
+
+func Double(n int) int {
+	return n * factor
+}
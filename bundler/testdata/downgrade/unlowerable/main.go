@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+func count(n int) func(yield func(int) bool) {
+	return func(yield func(int) bool) {
+		for i := 0; i < n; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
+
+func first() int {
+	for v := range count(3) {
+		return v
+	}
+	return -1
+}
+
+func main() {
+	var fs []func() int
+	for i := 0; i < 3; i++ {
+		fs = append(fs, func() int { return i })
+		i++
+	}
+	fmt.Println(first(), len(fs), slices.Max([]int{1, 2}))
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/embedfs/res"
+)
+
+type store struct {
+	files embed.FS
+}
+
+func main() {
+	s := store{files: res.Files}
+	fmt.Println(res.Read(s.files))
+}
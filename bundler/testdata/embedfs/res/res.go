@@ -0,0 +1,12 @@
+package res
+
+import "embed"
+
+//go:embed a.txt
+var Files embed.FS
+
+// Read returns the content of a.txt.
+func Read(f embed.FS) string {
+	b, _ := f.ReadFile("a.txt")
+	return string(b)
+}
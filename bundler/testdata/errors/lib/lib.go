@@ -0,0 +1,5 @@
+package lib
+
+func Twice(n int) int {
+	return n * undefined
+}
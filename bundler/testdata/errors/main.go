@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/errors/lib"
+	"github.com/Atnuhs/go-bundler/bundler/testdata/errors/syntax"
+)
+
+func main() {
+	fmt.Println(lib.Twice(2), syntax.One)
+}
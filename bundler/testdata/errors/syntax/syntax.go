@@ -0,0 +1,3 @@
+package syntax
+
+const One = (1
@@ -0,0 +1,18 @@
+//go:build !never
+
+// Copyright 2024 The Lib Authors. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package geo
+
+import "math"
+
+// Point is a point in the plane.
+type Point struct {
+	X float64 // abscissa
+	// Y is the ordinate.
+	Y float64
+}
+
+// Dist is the distance of p from the origin.
+func Dist(p Point) float64 { return math.Hypot(p.X, p.Y) } // Pythagoras
@@ -0,0 +1,54 @@
+// Copyright 2024 The Lib Authors. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+// Package lib is documented, but its doc is not a license.
+package lib
+
+import "fmt"
+
+// A is a number.
+type A int // trailing A
+
+type (
+	// B is grouped.
+	B string // trailing B
+
+	// C is unused.
+	C bool
+)
+
+// Limit is the limit.
+const Limit = 10 // trailing Limit
+
+// Colors.
+const (
+	// Red is red.
+	Red = iota // first
+	Green
+	Blue // last
+)
+
+var (
+	// X is x.
+	X = 1 // x
+	Y = 2
+)
+
+// Show prints a.
+//
+// It is documented.
+func Show(a A) {
+	// say it
+	fmt.Println(a, B("b"), Red, Blue, X) // inline
+	/* block */
+	if a > Limit {
+		// big
+		fmt.Println("big")
+	}
+	// last comment in body
+}
+
+// Twice doubles a.
+func (a A) Twice() A {
+	return a * 2 // double
+}
@@ -0,0 +1,16 @@
+// Command comments keeps the comments of its libraries.
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/comments/geo"
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/comments/lib"
+)
+
+// main prints a few values.
+func main() {
+	// show a number
+	lib.Show(lib.A(3).Twice()) // doubled
+	fmt.Println(geo.Dist(geo.Point{X: 3, Y: 4}))
+}
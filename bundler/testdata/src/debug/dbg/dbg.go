@@ -0,0 +1,14 @@
+package dbg
+
+import (
+	"fmt"
+	"os"
+)
+
+// Dump writes vs to stderr.
+//
+//bundler:debug
+func Dump(vs ...any) { fmt.Fprintln(os.Stderr, format(vs)) }
+
+// format is only used by Dump.
+func format(vs []any) string { return fmt.Sprint(vs...) }
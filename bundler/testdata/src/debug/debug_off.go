@@ -0,0 +1,5 @@
+//go:build !debugon
+
+package main
+
+const debug = false
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/debug/dbg"
+)
+
+type Table [][]int
+
+// Dump prints t when debugging.
+//
+//bundler:debug
+func (t Table) Dump() { dbg.Dump(t) }
+
+// dumpRow is only called in debug blocks.
+func dumpRow(row []int) { fmt.Println(row) }
+
+func main() {
+	n := 4
+	steps := 0
+	defer dbg.Dump("done")
+	dp := make(Table, n)
+	for i := range dp {
+		dp[i] = make([]int, n)
+		for j := range dp[i] {
+			if i == 0 || j == 0 {
+				dp[i][j] = 1
+			} else {
+				dp[i][j] = dp[i-1][j] + dp[i][j-1]
+			}
+			steps++
+		}
+		if debug {
+			dumpRow(dp[i])
+		}
+	}
+	dbg.Dump("steps", steps)
+	large := 0
+outer:
+	for i := range dp {
+		for j := range dp[i] {
+			if debug {
+				dumpRow(dp[i])
+				continue outer
+			}
+			if dp[i][j] > 3 {
+				large++
+			}
+		}
+	}
+	fmt.Println(large)
+	dp.Dump()
+	trace := []int{n, steps}
+	dbg.Dump(trace)
+	last := dp[n-1]
+	if debug {
+		dumpRow(last)
+	}
+
+	if n > 10 {
+		fmt.Println("large")
+	} else if debug {
+		dumpRow(dp[0])
+	} else {
+		fmt.Println("small")
+	}
+	if debug && n > 0 {
+		fmt.Println("debugging")
+	} else {
+		fmt.Println(dp[n-1][n-1])
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/downgrade/seq"
+)
+
+func main() {
+	// range over int
+	for i := range 3 {
+		fmt.Println("int", i)
+	}
+	var n int64 = 2
+	for i := range n {
+		fmt.Println("int64", i)
+	}
+	var k uint8
+	for k = range 2 {
+	}
+	for range 2 {
+		fmt.Println("no key", k)
+	}
+
+	// builtins
+	fmt.Println(min(3, 1, 2), max(2.5, 1), min(n, 5), max("a", "b"))
+	s := []int{1, 2}
+	m := map[string]int{"a": 1}
+	seq.Reset(s, m)
+	clear(s)
+	fmt.Println(s, len(m))
+
+	// per-iteration loop variables
+	var fs []func() int
+	for i := 0; i < 3; i++ {
+		fs = append(fs, func() int { return i })
+	}
+	for _, v := range []int{4, 5} {
+		fs = append(fs, func() int { return v })
+	}
+	for _, f := range fs {
+		fmt.Print(f(), " ")
+	}
+	fmt.Println()
+
+	// range over func
+outer:
+	for i, v := range seq.All([]string{"x", "y", "z", "w"}) {
+		switch {
+		case i == 0:
+			continue
+		case v == "z":
+			break outer
+		}
+		for j := range 3 {
+			if j == 1 {
+				continue
+			}
+			fmt.Println("pair", i, v, j)
+		}
+	}
+	for v := range seq.Count(10) {
+		if v > 2 {
+			break
+		}
+		fmt.Println("count", v)
+	}
+}
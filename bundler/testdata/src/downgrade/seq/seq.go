@@ -0,0 +1,29 @@
+package seq
+
+// Count yields 0, 1, ..., n-1.
+func Count(n int) func(yield func(int) bool) {
+	return func(yield func(int) bool) {
+		for i := range n {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
+
+// All yields the indices and elements of s.
+func All[E any](s []E) func(yield func(int, E) bool) {
+	return func(yield func(int, E) bool) {
+		for i, v := range s {
+			if !yield(i, v) {
+				return
+			}
+		}
+	}
+}
+
+// Reset zeroes s and empties m.
+func Reset[K comparable, V any](s []V, m map[K]V) {
+	clear(s)
+	clear(m)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/embed/table"
+)
+
+func main() {
+	fmt.Print(table.Greeting)
+	fmt.Println(len(table.Primes), table.Primes[0])
+	fmt.Println(table.Prime(3))
+	fmt.Print(table.Names)
+
+	entries, err := fs.ReadDir(table.Data, "data")
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		b, err := table.Data.ReadFile("data/" + e.Name())
+		fmt.Printf("%s %q %v\n", e.Name(), b, err)
+	}
+	if _, err := table.Data.ReadFile("data/_skip/x.txt"); err != nil {
+		fmt.Println("skipped")
+	}
+	fs.WalkDir(table.Data, ".", func(path string, d fs.DirEntry, err error) error {
+		fmt.Println(path, d.IsDir())
+		return err
+	})
+}
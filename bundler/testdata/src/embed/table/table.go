@@ -0,0 +1,35 @@
+// Package table holds precomputed tables embedded from files.
+package table
+
+import (
+	"embed"
+	_ "embed"
+	"strconv"
+	"strings"
+)
+
+// Greeting is read as is.
+//
+//go:embed greeting.txt
+var Greeting string // with a trailing newline
+
+// Primes are the first primes, one per line.
+//
+//go:embed primes.txt
+var Primes []byte
+
+// Names is read from a file whose name has a space.
+//
+//go:embed "my table.txt"
+var Names string
+
+// Data holds the data directory but its _ files.
+//
+//go:embed data
+var Data embed.FS
+
+// Prime returns the i-th prime.
+func Prime(i int) int {
+	n, _ := strconv.Atoi(strings.Fields(string(Primes))[i])
+	return n
+}
@@ -0,0 +1,56 @@
+package enum
+
+type Kind int
+
+const (
+	Unknown Kind = iota
+	Int
+	Float
+	String
+	Slice
+	Map
+)
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+	GB
+	TB
+)
+
+const (
+	North, South = iota, iota + 10
+	East, West
+	Up, Down
+)
+
+const Pi, E = 3.14159, 2.71828
+
+const (
+	A = 'a' + iota
+	B
+	C
+)
+
+const (
+	Third = 1.0 / (3 * (iota + 1))
+	Sixth
+	Ninth
+)
+
+const (
+	I0 = complex(0, iota)
+	I1
+	I2
+)
+
+func (k Kind) Name() string {
+	switch k {
+	case Int:
+		return "int"
+	case Map:
+		return "map"
+	}
+	return "other"
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/groups/enum"
+)
+
+var (
+	a, b, c = 1, 2, 3
+	x, y    int
+	p, q    = pair()
+	unused  = []int{1, 2, 3}
+	logged  = fmt.Sprint("side effect")
+)
+
+func pair() (int, int) { return 4, 5 }
+
+func main() {
+	fmt.Println(enum.Int.Name(), enum.Map.Name(), int(enum.Slice))
+	fmt.Println(enum.MB, enum.TB)
+	fmt.Println(enum.West, enum.Up)
+	fmt.Println(enum.E)
+	fmt.Printf("%T %c\n", enum.C, enum.C)
+	fmt.Println(enum.Sixth*6 == 1, enum.Ninth*9 == 1)
+	fmt.Println(enum.I2)
+	fmt.Println(b, y, q)
+}
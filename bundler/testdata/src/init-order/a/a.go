@@ -0,0 +1,15 @@
+package a
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/init-order/c"
+)
+
+func init() {
+	fmt.Println("a init")
+}
+
+func Name() string {
+	return "a:" + c.Lookup("a")
+}
@@ -0,0 +1,15 @@
+package b
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/init-order/c"
+)
+
+func init() {
+	fmt.Println("b init")
+}
+
+func Name() string {
+	return "b:" + c.Lookup("b")
+}
@@ -0,0 +1,19 @@
+package c
+
+import "fmt"
+
+var table = map[string]string{}
+
+func init() {
+	fmt.Println("c1 init 1")
+	table["a"] = "alpha"
+}
+
+func init() {
+	fmt.Println("c1 init 2")
+	table["b"] = "beta"
+}
+
+func Lookup(key string) string {
+	return table[key]
+}
@@ -0,0 +1,7 @@
+package c
+
+import "fmt"
+
+func init() {
+	fmt.Println("c2 init")
+}
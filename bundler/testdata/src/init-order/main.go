@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/init-order/a"
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/init-order/b"
+)
+
+func init() {
+	fmt.Println("main init 1")
+}
+
+func init() {
+	fmt.Println("main init 2")
+}
+
+func main() {
+	fmt.Println(a.Name(), b.Name())
+}
@@ -0,0 +1,14 @@
+package counter
+
+import "fmt"
+
+var calls int
+
+// Next counts a call and reports which initializer made it.
+func Next(name string) int {
+	calls++
+	fmt.Println(calls, name)
+	return calls
+}
+
+var Base = Next("counter.Base")
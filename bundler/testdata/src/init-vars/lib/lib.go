@@ -0,0 +1,21 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/init-vars/counter"
+)
+
+var Table = build()
+
+var Size = len(Table)
+
+func build() []int {
+	n := counter.Next("lib.Table")
+	return make([]int, n)
+}
+
+func init() {
+	fmt.Println("lib init")
+	Table = append(Table, counter.Next("lib init"))
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/init-vars/counter"
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/init-vars/lib"
+)
+
+var (
+	y = x + counter.Next("main.y")
+	x = counter.Next("main.x")
+)
+
+var size = len(lib.Table)
+
+var limit = 10
+
+var _ = counter.Next("main._")
+
+var unused = counter.Next("main.unused")
+
+func init() {
+	fmt.Println("main init", x, y, size)
+}
+
+func main() {
+	fmt.Println(x, y, size, limit, lib.Size, counter.Base)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+type item struct {
+	name  string
+	score int
+}
+
+func main() {
+	items := []item{{"b", 2}, {"a", 2}, {"c", 1}}
+	slices.SortFunc(items, func(x, y item) int {
+		return cmp.Or(cmp.Compare(y.score, x.score), strings.Compare(x.name, y.name))
+	})
+	fmt.Println(items)
+
+	xs := []int{5, 2, 8, 2}
+	slices.Sort(xs)
+	fmt.Println(xs, slices.Index(xs, 8), slices.Contains(xs, 3), slices.Max(xs))
+
+	count := map[string]int{"x": 1, "y": 2}
+	keys := slices.Sorted(maps.Keys(count))
+	fmt.Println(keys)
+}
@@ -0,0 +1,81 @@
+package ds
+
+// UnionFind is a disjoint-set forest.
+type UnionFind struct {
+	parent []int
+	size   []int
+}
+
+func NewUnionFind(n int) *UnionFind {
+	uf := &UnionFind{parent: make([]int, n), size: make([]int, n)}
+	for i := range uf.parent {
+		uf.parent[i] = i
+		uf.size[i] = 1
+	}
+	return uf
+}
+
+func (uf *UnionFind) Find(x int) int {
+	for uf.parent[x] != x {
+		uf.parent[x] = uf.parent[uf.parent[x]]
+		x = uf.parent[x]
+	}
+	return x
+}
+
+func (uf *UnionFind) Union(x, y int) bool {
+	x, y = uf.Find(x), uf.Find(y)
+	if x == y {
+		return false
+	}
+	if uf.size[x] < uf.size[y] {
+		x, y = y, x
+	}
+	uf.parent[y] = x
+	uf.size[x] += uf.size[y]
+	return true
+}
+
+func (uf *UnionFind) Same(x, y int) bool {
+	return uf.Find(x) == uf.Find(y)
+}
+
+func (uf *UnionFind) Size(x int) int {
+	return uf.size[uf.Find(x)]
+}
+
+func (uf *UnionFind) Groups() [][]int {
+	groups := make(map[int][]int)
+	for i := range uf.parent {
+		r := uf.Find(i)
+		groups[r] = append(groups[r], i)
+	}
+	ret := make([][]int, 0, len(groups))
+	for _, g := range groups {
+		ret = append(ret, g)
+	}
+	return ret
+}
+
+// Stack is a LIFO stack.
+type Stack[T any] struct {
+	items []T
+}
+
+func (s *Stack[T]) Push(v T) {
+	s.items = append(s.items, v)
+}
+
+func (s *Stack[T]) Pop() T {
+	v := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return v
+}
+
+func (s *Stack[T]) Peek() T {
+	return s.items[len(s.items)-1]
+}
+
+func (s *Stack[T]) Len() int {
+	return len(s.items)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/methods/ds"
+)
+
+// ModInt prints itself through fmt.Stringer.
+type ModInt int
+
+func (m ModInt) String() string      { return fmt.Sprintf("%d (mod 7)", int(m)%7) }
+func (m ModInt) Add(n ModInt) ModInt { return (m + n) % 7 }
+func (m ModInt) Mul(n ModInt) ModInt { return m * n % 7 }
+func (m ModInt) Inv() ModInt         { return m }
+
+// byLen is sorted through sort.Interface.
+type byLen []string
+
+func (s byLen) Len() int           { return len(s) }
+func (s byLen) Less(i, j int) bool { return len(s[i]) < len(s[j]) }
+func (s byLen) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLen) Total() int         { return len(s) }
+
+type Shape interface {
+	Area() int
+}
+
+type Perimeterer interface {
+	Perimeter() int
+}
+
+type Square struct{ side int }
+
+// Area is never called, but Square is converted to Shape.
+func (s Square) Area() int      { return s.side * s.side }
+func (s Square) Perimeter() int { return 4 * s.side }
+func (s Square) Diagonal() int  { return s.side * 14 / 10 }
+
+type Greeting struct{}
+
+func (Greeting) Hello() string { return "hello" }
+func (Greeting) Bye() string   { return "bye" }
+
+// Outer gets Hello through embedding.
+type Outer struct{ Greeting }
+
+type Greeter interface {
+	Hello() string
+}
+
+type Num int
+
+func (n Num) Less(m Num) bool { return n < m }
+func (n Num) Zero() Num       { return 0 }
+func (n Num) Neg() Num        { return -n }
+
+func Max[T interface {
+	Less(T) bool
+	Zero() T
+}](xs ...T) T {
+	var m T
+	for i, x := range xs {
+		if i == 0 || m.Less(x) {
+			m = x
+		}
+	}
+	return m
+}
+
+func main() {
+	uf := ds.NewUnionFind(4)
+	uf.Union(0, 1)
+	fmt.Println(uf.Find(1) == uf.Find(0), uf.Find(2))
+
+	var st ds.Stack[string]
+	st.Push("a")
+	st.Push("b")
+	fmt.Println(st.Pop(), st.Len())
+
+	fmt.Println(ModInt(3).Add(5))
+
+	words := byLen{"ccc", "a", "bb"}
+	sort.Sort(words)
+	fmt.Println(words)
+
+	shapes := []Shape{Square{2}}
+	var x any = shapes[0]
+	if p, ok := x.(Perimeterer); ok {
+		fmt.Println("has perimeter", p != nil)
+	}
+	fmt.Println(len(shapes))
+
+	var g Greeter = Outer{}
+	fmt.Println(g != nil)
+
+	fmt.Println(Max(Num(3), Num(5), Num(1)))
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/minify/util"
+)
+
+func main() {
+	// locals named like the short names of the library
+	a, b, c := 1, 2, 3
+	fmt.Println(util.Double(a+b+c), util.Sum(1.5, 2.5), util.Sum(a, b))
+	fmt.Println(util.Apply([]int{a, b}, util.Double))
+
+	next := util.Counter()
+	next()
+	fmt.Println(next())
+
+	n := util.Named{Base: util.Base{ID: 7}, Name: "seven"}
+	fmt.Printf("%v %+v\n", n, n.Base)
+
+	var s util.Stack[string]
+	s.Push("x")
+	v, ok := s.Pop()
+	_, empty := s.Pop()
+	fmt.Println(v, ok, empty)
+}
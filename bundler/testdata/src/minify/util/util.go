@@ -0,0 +1,60 @@
+package util
+
+import "fmt"
+
+// Base is embedded by Named, so it keeps its name.
+type Base struct{ ID int }
+
+type Named struct {
+	Base
+	Name string
+}
+
+func (n Named) String() string { return fmt.Sprintf("%d:%s", n.ID, n.Name) }
+
+var a = 10
+
+// b declares a local shadowing the package-level a.
+func b(c int) int {
+	a := c * 2
+	return a
+}
+
+func Double(x int) int { return b(x) + a }
+
+func Sum[T ~int | ~float64](xs ...T) T {
+	var s T
+	for _, x := range xs {
+		s += x
+	}
+	return s
+}
+
+func Apply(xs []int, f func(int) int) []int {
+	out := make([]int, 0, len(xs))
+	for _, x := range xs {
+		out = append(out, f(x))
+	}
+	return out
+}
+
+func Counter() func() int {
+	n := 0
+	return func() int {
+		n++
+		return n
+	}
+}
+
+type Stack[T any] struct{ items []T }
+
+func (s *Stack[T]) Push(v T) { s.items = append(s.items, v) }
+
+func (s *Stack[T]) Pop() (v T, ok bool) {
+	if len(s.items) == 0 {
+		return v, false
+	}
+	v = s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return v, true
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"fmt"
 
-	"github.com/Atnuhs/go-bundler/testdata/src/single-deps/lib"
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/single-deps/lib"
 )
 
 func init_sub() {
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/stdin/scan"
+)
+
+func main() {
+	sum := 0
+	for {
+		n, ok := scan.Int()
+		if !ok {
+			break
+		}
+		sum += n
+	}
+	fmt.Println(sum)
+	if sum < 0 {
+		os.Exit(2)
+	}
+}
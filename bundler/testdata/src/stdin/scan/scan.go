@@ -0,0 +1,25 @@
+package scan
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+)
+
+var sc = bufio.NewScanner(os.Stdin)
+
+func init() {
+	sc.Split(bufio.ScanWords)
+}
+
+// Int reads the next integer from stdin. ok is false at the end of input.
+func Int() (n int, ok bool) {
+	if !sc.Scan() {
+		return 0, false
+	}
+	n, err := strconv.Atoi(sc.Text())
+	if err != nil {
+		panic(err)
+	}
+	return n, true
+}
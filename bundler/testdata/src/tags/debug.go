@@ -0,0 +1,7 @@
+//go:build debug
+
+package main
+
+import "fmt"
+
+func debugf(format string, args ...any) { fmt.Printf("debug: "+format+"\n", args...) }
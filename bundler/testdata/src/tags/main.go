@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/tags/sys"
+)
+
+func main() {
+	debugf("starting")
+	fmt.Println(sys.Name())
+}
@@ -0,0 +1,5 @@
+//go:build !debug
+
+package main
+
+func debugf(format string, args ...any) {}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package sys
+
+// Name is the system the program is built for.
+func Name() string { return "not windows" }
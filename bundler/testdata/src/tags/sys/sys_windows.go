@@ -0,0 +1,4 @@
+package sys
+
+// Name is the system the program is built for.
+func Name() string { return "windows" }
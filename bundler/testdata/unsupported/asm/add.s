@@ -0,0 +1,3 @@
+//go:build !purego
+
+// add is only read by go list, never assembled.
@@ -0,0 +1,5 @@
+//go:build purego && unix && go1.21
+
+package asm
+
+func add(a, b int) int { return a + b }
@@ -0,0 +1,5 @@
+//go:build purego
+
+package asm
+
+func add(a, b int) int { return b + a }
@@ -0,0 +1,9 @@
+package link
+
+import _ "unsafe"
+
+//go:linkname nanotime runtime.nanotime
+func nanotime() int64
+
+// Now is the monotonic time.
+func Now() int64 { return nanotime() }
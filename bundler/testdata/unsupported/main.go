@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/unsupported/asm"
+	"github.com/Atnuhs/go-bundler/bundler/testdata/unsupported/link"
+)
+
+func main() {
+	fmt.Println(asm.Add(1, 2), link.Now() > 0)
+}
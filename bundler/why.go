@@ -0,0 +1,183 @@
+package bundler
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Reason tells why a declaration is bundled.
+type Reason string
+
+const (
+	// ReasonEntry marks main and the initializer of the main package.
+	ReasonEntry Reason = "entry point"
+	// ReasonCalled marks functions called in the RTA call graph.
+	ReasonCalled Reason = "called"
+	// ReasonReferenced marks declarations referred to by name.
+	ReasonReferenced Reason = "referenced"
+	// ReasonType marks types referred to by name.
+	ReasonType Reason = "referenced type"
+	// ReasonInterface marks methods needed to implement an interface or to
+	// satisfy a constraint.
+	ReasonInterface Reason = "interface method"
+	// ReasonInitializer marks vars whose initializers have side effects, and
+	// declarations package-level var initializers depend on.
+	ReasonInitializer Reason = "initializer dependency"
+	// ReasonReflection marks methods kept because the program looks up
+	// methods by reflection.
+	ReasonReflection Reason = "reflection"
+)
+
+// WhyStep is a declaration on the chain from an entry point to a bundled
+// declaration.
+type WhyStep struct {
+	Decl   string
+	Reason Reason
+}
+
+// Inclusion explains why a declaration is bundled.
+type Inclusion struct {
+	// Package is the import path of the package declaring Decl.
+	Package string
+
+	// Decl names the declaration qualified by its package name, such as
+	// "lib.Func", "lib.Type.Method" or "lib.init#1" for the first init
+	// function of lib.
+	Decl   string
+	Reason Reason
+
+	// Path is the shortest chain from an entry point to Decl, both included.
+	Path []WhyStep
+}
+
+// matches reports whether name is Decl, or Decl qualified by the import path
+// instead of the package name.
+func (in Inclusion) matches(name string) bool {
+	if name == in.Decl {
+		return true
+	}
+	_, rest, _ := strings.Cut(in.Decl, ".")
+	return name == in.Package+"."+rest
+}
+
+// Why returns the inclusions of the declarations named name, as in
+// Inclusion.Decl or qualified by import path.
+func (r Result) Why(name string) []Inclusion {
+	var ret []Inclusion
+	for _, in := range r.Inclusions {
+		if in.matches(name) {
+			ret = append(ret, in)
+		}
+	}
+	return ret
+}
+
+// inclusions explains every bundled declaration in package and source order.
+func (b *Bundler) inclusions() []Inclusion {
+	names := b.initFuncDeclNames()
+	a := b.analysis
+
+	var ret []Inclusion
+	add := func(pkg string, obj types.Object) {
+		if obj == nil || !a.reachableDecls[obj] {
+			return
+		}
+		in := Inclusion{
+			Package: pkg,
+			Decl:    declString(obj, names),
+			Reason:  a.reasons[obj],
+		}
+		for cur := obj; cur != nil; cur = a.parents[cur] {
+			in.Path = append(in.Path, WhyStep{Decl: declString(cur, names), Reason: a.reasons[cur]})
+		}
+		for i, j := 0, len(in.Path)-1; i < j; i, j = i+1, j-1 {
+			in.Path[i], in.Path[j] = in.Path[j], in.Path[i]
+		}
+		ret = append(ret, in)
+	}
+
+	for _, pkg := range b.topoPkgs {
+		for _, obj := range pkgDecls(pkg) {
+			add(pkg.PkgPath, obj)
+		}
+	}
+	return ret
+}
+
+// pkgDecls returns the objects of the package-level declarations of pkg in
+// source order.
+func pkgDecls(pkg *packages.Package) []types.Object {
+	info := pkg.TypesInfo
+	var ret []types.Object
+	add := func(id *ast.Ident) {
+		if obj := info.Defs[id]; obj != nil && obj.Name() != "_" {
+			ret = append(ret, obj)
+		}
+	}
+	for _, f := range pkg.Syntax {
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				add(d.Name)
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						add(s.Name)
+					case *ast.ValueSpec:
+						for _, name := range s.Names {
+							add(name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// initFuncDeclNames names the init functions of the bundled packages init#1,
+// init#2, ... in file order, as SSA does.
+func (b *Bundler) initFuncDeclNames() map[types.Object]string {
+	names := make(map[types.Object]string)
+	for _, pkg := range b.topoPkgs {
+		n := 0
+		for _, f := range pkg.Syntax {
+			for _, decl := range f.Decls {
+				d, ok := decl.(*ast.FuncDecl)
+				if !ok || d.Recv != nil {
+					continue
+				}
+				// the AST name may already be replaced by its helper name
+				if obj := pkg.TypesInfo.Defs[d.Name]; obj != nil && obj.Name() == "init" {
+					n++
+					names[obj] = fmt.Sprintf("init#%d", n)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// declString names obj qualified by its package name.
+func declString(obj types.Object, initNames map[types.Object]string) string {
+	name := obj.Name()
+	if n, ok := initNames[obj]; ok {
+		name = n
+	}
+	if f, ok := obj.(*types.Func); ok {
+		if recv := f.Type().(*types.Signature).Recv(); recv != nil {
+			if named := namedTypeOf(recv.Type()); named != nil {
+				name = named.Obj().Name() + "." + name
+			}
+		}
+	}
+	if obj.Pkg() == nil {
+		return name
+	}
+	return obj.Pkg().Name() + "." + name
+}
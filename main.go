@@ -2,78 +2,413 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
-	"golang.org/x/tools/go/packages"
-	"golang.org/x/tools/imports"
+	"github.com/Atnuhs/go-bundler/bundler"
 )
 
 var Level = new(slog.LevelVar)
 
 func init() {
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	// stdout is reserved for the bundled source
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 		Level: Level,
 	})))
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "remap" {
+		remap(os.Args[2:])
+		return
+	}
+
 	dir := flag.String("dir", ".", "target package directory")
+	check := flag.Bool("check", false, "type-check the bundled source before writing it")
+	out := flag.String("o", "", "write the bundled source to `path` instead of stdout")
+	sourceMap := flag.String("sourcemap", "", "write the source map of the bundled source to `path` as JSON, for go-bundler remap")
+	outdir := flag.String("outdir", "", "write each main package to `dir`/<package dir>/main.go")
+	tags := flag.String("tags", "", "load packages with the comma-separated build `tags`")
+	goos := flag.String("goos", "", "select files for the target `os` of the judge, such as windows")
+	goarch := flag.String("goarch", "", "select files for the target `arch` of the judge, such as amd64")
+	profile := flag.String("profile", "", "preset the build tags, target system and Go version of the judge `name`: atcoder or codeforces")
+	targetGo := flag.String("target-go", "", "rewrite newer constructs for Go `version` such as 1.20")
+	inlineStd := flag.String("inline-std", "", "bundle the comma-separated std `packages` instead of importing them")
+	why := flag.String("why", "", "explain why `decl`, such as lib.Func or lib.Type.Method, is bundled")
+	whyAll := flag.Bool("why-all", false, "explain why each declaration is bundled")
+	annotate := flag.String("annotate", "comment", "annotate each declaration with its original position: `mode` comment, line for //line directives, or none")
+	comments := flag.Bool("comments", false, "keep doc and body comments, and the license headers of library packages")
+	minify := flag.Bool("minify", false, "rename library declarations and their locals to short names")
+	maxSize := flag.String("max-size", "", "compact the bundled source to fit `size`, such as 512KiB, or fail")
+	stats := flag.Bool("stats", false, "print the size of the bundled source by package and declaration kind")
+	graph := flag.String("graph", "", "write the import and declaration graphs in `format` dot or json instead of the bundled source")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: go-bundler [flags] [packages]\n       go-bundler remap [flags] [file]\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	pkgs, err := loadPackages(*dir)
+	switch *graph {
+	case "", "dot", "json":
+	default:
+		log.Fatalf("-graph: unknown format %q, want dot or json", *graph)
+	}
+	if *graph != "" && *outdir != "" {
+		log.Fatal("-graph cannot be used with -outdir")
+	}
+	if *sourceMap != "" && *outdir != "" {
+		log.Fatal("-sourcemap cannot be used with -outdir")
+	}
+
+	opts := bundler.Options{
+		Dir:      *dir,
+		Patterns: flag.Args(),
+		Check:    *check,
+		TargetGo: *targetGo,
+		Comments: *comments,
+		Minify:   *minify,
+		Annotate: bundler.Annotation(*annotate),
+		GOOS:     *goos,
+		GOARCH:   *goarch,
+		Profile:  *profile,
+	}
+	if *tags != "" {
+		opts.Tags = strings.Split(*tags, ",")
+	}
+	if *inlineStd != "" {
+		opts.InlineStd = strings.Split(*inlineStd, ",")
+	}
+	if *maxSize != "" {
+		n, err := parseSize(*maxSize)
+		if err != nil {
+			log.Fatalf("-max-size: %v", err)
+		}
+		opts.MaxSize = n
+	}
+	results, err := bundler.BundleAll(context.Background(), opts)
 	if err != nil {
-		log.Fatalf("load packages: %v", err)
+		// one error per line, such as file:line: msg
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, r := range results {
+		if *why != "" {
+			if err := printWhy(os.Stderr, r, *why); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *whyAll {
+			printWhyAll(os.Stderr, r)
+		}
+		if len(r.Compactions) > 0 {
+			slog.Info("compacted", "package", r.Package, "size", len(r.Source), "compactions", strings.Join(r.Compactions, ", "))
+		}
+		if *stats {
+			printStats(os.Stderr, r)
+		}
+	}
+
+	if *graph != "" {
+		var buf bytes.Buffer
+		var files []string
+		for _, r := range results {
+			if err := writeGraph(&buf, r.Graph, *graph); err != nil {
+				log.Fatal(err)
+			}
+			files = append(files, r.Files...)
+		}
+		if err := writeOutput(*out, buf.Bytes(), files); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// single package: stdout or -o
+	if len(results) == 1 && *outdir == "" {
+		r := results[0]
+		if *sourceMap != "" {
+			var buf bytes.Buffer
+			if err := r.SourceMap.WriteJSON(&buf); err != nil {
+				log.Fatal(err)
+			}
+			if err := writeOutput(*sourceMap, buf.Bytes(), r.Files); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := writeOutput(*out, r.Source, r.Files); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// batch: one output per main package
+	if *out != "" {
+		log.Fatalf("-o cannot be used with %d main packages, use -outdir", len(results))
+	}
+	if *sourceMap != "" {
+		log.Fatalf("-sourcemap cannot be used with %d main packages", len(results))
+	}
+	for _, r := range results {
+		path, err := outputPath(r, *dir, *outdir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := checkNotSource(path, r.Files); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			log.Fatal(err)
+		}
+		if err := writeFileAtomic(path, r.Source); err != nil {
+			log.Fatalf("write %s: %v", path, err)
+		}
+		slog.Info("bundled", "package", r.Package, "output", path)
 	}
+}
 
-	// execute summarize
-	var raw bytes.Buffer
-	if err := Bundle(pkgs, &raw); err != nil {
-		log.Fatalf("bundle: %v", err)
+// remap runs the remap subcommand, which rewrites the positions in the
+// bundled file of a stack trace or compiler errors to the original ones.
+func remap(args []string) {
+	fs := flag.NewFlagSet("remap", flag.ExitOnError)
+	mapPath := fs.String("map", "", "read the source map from `path`, written with -sourcemap")
+	src := fs.String("src", "", "read the source map from the position comments of the bundled source at `path`")
+	name := fs.String("file", "main.go", "`name` of the bundled file in the trace, compared case-insensitively")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: go-bundler remap [flags] [file]\n\nRewrites a stack trace or compiler errors read from file, or stdin, to the\noriginal positions.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*mapPath == "") == (*src == "") {
+		log.Fatal("remap: exactly one of -map and -src is required")
+	}
+	if fs.NArg() > 1 {
+		log.Fatal("remap: at most one file")
 	}
 
-	// format with goimports
-	formatted, err := imports.Process("main.go", raw.Bytes(), &imports.Options{
-		Comments:  true,
-		TabIndent: true,
-		TabWidth:  4,
-	})
+	m, err := readSourceMap(*mapPath, *src)
 	if err != nil {
-		log.Fatalf("goimports: %v", err)
+		log.Fatalf("remap: %v", err)
+	}
+	if m.LineDirectives {
+		log.Print("remap: the bundled file has //line directives, its positions are original already")
+	}
+	in := os.Stdin
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			log.Fatalf("remap: %v", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	text, err := io.ReadAll(in)
+	if err != nil {
+		log.Fatalf("remap: %v", err)
+	}
+	if _, err := io.WriteString(os.Stdout, m.Remap(string(text), *name)); err != nil {
+		log.Fatalf("remap: %v", err)
+	}
+}
+
+// readSourceMap reads the source map at mapPath, or parses it from the
+// bundled source at src.
+func readSourceMap(mapPath, src string) (*bundler.SourceMap, error) {
+	if src != "" {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		return bundler.ParseSourceMap(data)
+	}
+	f, err := os.Open(mapPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return bundler.ReadSourceMap(f)
+}
+
+// parseSize parses a byte count with an optional KiB or MiB suffix.
+func parseSize(s string) (int, error) {
+	unit := 1
+	for suffix, n := range map[string]int{"KiB": 1 << 10, "MiB": 1 << 20} {
+		if num, ok := strings.CutSuffix(s, suffix); ok {
+			s, unit = num, n
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * unit, nil
+}
+
+// writeOutput writes data to stdout, or to path unless it is one of files.
+func writeOutput(path string, data []byte, files []string) error {
+	if path == "" {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return fmt.Errorf("write stdout: %w", err)
+		}
+		return nil
+	}
+	if err := checkNotSource(path, files); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeGraph writes g in format dot or json.
+func writeGraph(w io.Writer, g bundler.Graph, format string) error {
+	if format == "dot" {
+		return g.WriteDOT(w)
+	}
+	return g.WriteJSON(w)
+}
+
+// printWhy prints the chains from main or init to the declarations named
+// name.
+func printWhy(w io.Writer, r bundler.Result, name string) error {
+	matches := r.Why(name)
+	if len(matches) == 0 {
+		return fmt.Errorf("%s: %s is not bundled", r.Package, name)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, in := range matches {
+		fmt.Fprintf(tw, "%s is bundled by %s:\n", in.Decl, r.Package)
+		for _, step := range in.Path {
+			fmt.Fprintf(tw, "\t%s\t%s\n", step.Decl, step.Reason)
+		}
+	}
+	return tw.Flush()
+}
+
+// printWhyAll prints each bundled declaration with its reason and the
+// declaration that caused it to be bundled.
+func printWhyAll(w io.Writer, r bundler.Result) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s:\n", r.Package)
+	for _, in := range r.Inclusions {
+		var by string
+		if len(in.Path) > 1 {
+			by = "by " + in.Path[len(in.Path)-2].Decl
+		}
+		fmt.Fprintf(tw, "\t%s\t%s\t%s\n", in.Decl, in.Reason, by)
 	}
-	if _, err := os.Stdout.Write(formatted); err != nil {
-		log.Fatalf("write stdout: %v", err)
+	tw.Flush()
+}
+
+// printStats prints the bytes and lines each package and declaration kind
+// contributes to the bundled source, and how many declarations are kept.
+func printStats(w io.Writer, r bundler.Result) {
+	st := r.Stats
+	percent := func(n int) string {
+		if st.Total.Bytes == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(st.Total.Bytes))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s:\n", r.Package)
+	fmt.Fprintf(tw, "\tpackage\tdecls\tbytes\t\tlines\n")
+	for _, p := range st.Packages {
+		fmt.Fprintf(tw, "\t%s\t%d/%d\t%d\t%s\t%d\n", p.Package, p.Reachable, p.Total, p.Size.Bytes, percent(p.Size.Bytes), p.Size.Lines)
+		for _, k := range []struct {
+			name string
+			size bundler.Size
+		}{
+			{"types", p.Types},
+			{"funcs", p.Funcs},
+			{"methods", p.Methods},
+			{"consts", p.Consts},
+			{"vars", p.Vars},
+		} {
+			if k.size.Bytes > 0 {
+				fmt.Fprintf(tw, "\t  %s\t\t%d\t%s\t%d\n", k.name, k.size.Bytes, percent(k.size.Bytes), k.size.Lines)
+			}
+		}
 	}
+	fmt.Fprintf(tw, "\tother\t\t%d\t%s\t%d\n", st.Other.Bytes, percent(st.Other.Bytes), st.Other.Lines)
+	fmt.Fprintf(tw, "\ttotal\t\t%d\t\t%d\n", st.Total.Bytes, st.Total.Lines)
+	tw.Flush()
 }
 
-func loadPackages(dir string) ([]*packages.Package, error) {
+// outputPath returns where the main package r is written in batch mode:
+// <package dir>/bundled/main.go, or <outdir>/<package dir relative to dir>/main.go.
+func outputPath(r bundler.Result, dir, outdir string) (string, error) {
+	if r.Dir == "" {
+		return "", fmt.Errorf("%s: no Go files", r.Package)
+	}
+	if outdir == "" {
+		return filepath.Join(r.Dir, "bundled", "main.go"), nil
+	}
+
 	absDir, err := filepath.Abs(dir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get abs path of %s", dir)
+		return "", err
+	}
+	rel, err := filepath.Rel(absDir, r.Dir)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s is outside of %s", r.Dir, absDir)
 	}
+	return filepath.Join(outdir, rel, "main.go"), nil
+}
+
+// checkNotSource returns an error if path is one of the source files of the
+// bundled packages.
+func checkNotSource(path string, files []string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	fi, statErr := os.Stat(abs)
 
-	cfg := &packages.Config{
-		Mode: packages.NeedName |
-			packages.NeedFiles |
-			packages.NeedSyntax |
-			packages.NeedTypes |
-			packages.NeedTypesInfo |
-			packages.NeedDeps |
-			packages.NeedModule |
-			packages.NeedCompiledGoFiles |
-			packages.NeedImports,
-		Dir:   absDir,
-		Tests: false,
+	for _, f := range files {
+		if f == abs {
+			return fmt.Errorf("refusing to overwrite source file %s", f)
+		}
+		if statErr != nil {
+			continue
+		}
+		if gi, err := os.Stat(f); err == nil && os.SameFile(fi, gi) {
+			return fmt.Errorf("refusing to overwrite source file %s", f)
+		}
 	}
+	return nil
+}
 
-	pkgs, err := packages.Load(cfg, ".")
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// to path, so that readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
 	if err != nil {
-		return nil, fmt.Errorf("failed to load package: %w", err)
+		return err
 	}
+	defer os.Remove(tmp.Name())
 
-	return pkgs, nil
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
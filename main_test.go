@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Atnuhs/go-bundler/bundler"
+)
+
+func TestCheckNotSource(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "lib", "lib.go")
+	if err := os.MkdirAll(filepath.Dir(src), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, []byte("package lib\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{src}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{
+			name:    "source file",
+			path:    src,
+			wantErr: true,
+		},
+		{
+			name:    "same file by another path",
+			path:    filepath.Join(dir, "lib", "..", "lib", "lib.go"),
+			wantErr: true,
+		},
+		{
+			name: "new file",
+			path: filepath.Join(dir, "main.go"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkNotSource(tt.path, files)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkNotSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new")); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "new" {
+		t.Errorf("content = %q, want %q", got, "new")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("files in dir = %d, want 1 (temporary file left behind)", len(entries))
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	absDir, err := filepath.Abs("contest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bundler.Result{Dir: filepath.Join(absDir, "abc/b")}
+
+	tests := []struct {
+		name   string
+		outdir string
+		want   string
+	}{
+		{
+			name: "next to package",
+			want: filepath.Join(absDir, "abc/b/bundled/main.go"),
+		},
+		{
+			name:   "outdir",
+			outdir: "out",
+			want:   filepath.Join("out", "abc/b/main.go"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := outputPath(r, "contest", tt.outdir)
+			if err != nil {
+				t.Fatalf("outputPath() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("outputPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}